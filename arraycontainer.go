@@ -1,6 +1,9 @@
 package roaring
 
-import "unsafe"
+import (
+	"fmt"
+	"unsafe"
+)
 
 type arrayContainer struct {
 	content []uint16
@@ -12,10 +15,50 @@ func (ac *arrayContainer) fillLeastSignificant16bits(x []uint32, i int, mask uin
 	}
 }
 
-func (ac *arrayContainer) getShortIterator() shortIterable {
+func (ac *arrayContainer) getShortIterator() shortPeekable {
 	return &shortIterator{ac.content, 0}
 }
 
+func (ac *arrayContainer) getReverseIterator() shortIterable {
+	return &reverseIterator{ac.content, len(ac.content) - 1}
+}
+
+func (ac *arrayContainer) iterate(hs uint32, f func(uint32) bool) bool {
+	for _, v := range ac.content {
+		if !f(uint32(v) | hs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ac *arrayContainer) nextRun(from int) (int, int) {
+	if from >= maxCapacity {
+		return -1, -1
+	}
+	i := advanceUntil(ac.content, -1, len(ac.content), uint16(from))
+	if i == len(ac.content) {
+		return -1, -1
+	}
+	j := i + 1
+	for j < len(ac.content) && ac.content[j] == ac.content[j-1]+1 {
+		j++
+	}
+	return int(ac.content[i]), int(ac.content[j-1])
+}
+
+// nextMany fills buf with the values from index cursor on
+func (ac *arrayContainer) nextMany(hs uint32, buf []uint32, cursor int) (int, int) {
+	n := len(ac.content) - cursor
+	if len(buf) < n {
+		n = len(buf)
+	}
+	for i, v := range ac.content[cursor : cursor+n] {
+		buf[i] = uint32(v) | hs
+	}
+	return n, cursor + n
+}
+
 func (ac *arrayContainer) getSizeInBytes() int {
 	// unsafe.Sizeof calculates the memory used by the top level of the slice
 	// descriptor - not including the size of the memory referenced by the slice.
@@ -94,11 +137,13 @@ func (ac *arrayContainer) iaddRange(firstOfRange, lastOfRange int) container {
 	if cap(ac.content) < newcardinality {
 		tmp := make([]uint16, newcardinality, newcardinality)
 		copy(tmp[:indexstart], ac.content[:indexstart])
+		copy(tmp[indexstart+rangelength:], ac.content[indexend:])
 		ac.content = tmp
 	} else {
+		old := ac.content
 		ac.content = ac.content[:newcardinality]
+		copy(ac.content[indexstart+rangelength:], old[indexend:])
 	}
-	copy(ac.content[indexstart+rangelength:], ac.content[indexend:])
 	for k := 0; k < rangelength; k++ {
 		ac.content[k+indexstart] = uint16(firstOfRange + k)
 	}
@@ -177,6 +222,9 @@ func (ac *arrayContainer) not(firstOfRange, lastOfRange int) container {
 }
 
 func (ac *arrayContainer) equals(o interface{}) bool {
+	if rc, ok := o.(*runContainer); ok {
+		return rc.equals(ac)
+	}
 	srb, ok := o.(*arrayContainer)
 	if ok {
 		// Check if the containers are the same object.
@@ -198,6 +246,35 @@ func (ac *arrayContainer) equals(o interface{}) bool {
 	return false
 }
 
+func (ac *arrayContainer) validate() error {
+	for i := 1; i < len(ac.content); i++ {
+		if ac.content[i] <= ac.content[i-1] {
+			return fmt.Errorf("%w: array values are not strictly increasing", ErrCorrupt)
+		}
+	}
+	return nil
+}
+
+func (ac *arrayContainer) numberOfRuns() int {
+	if len(ac.content) == 0 {
+		return 0
+	}
+	nr := 1
+	for i := 1; i < len(ac.content); i++ {
+		if ac.content[i] != ac.content[i-1]+1 {
+			nr++
+		}
+	}
+	return nr
+}
+
+func (ac *arrayContainer) toEfficientContainer() container {
+	if runContainerSerializedSizeInBytes(ac.numberOfRuns()) < ac.serializedSizeInBytes() {
+		return newRunContainerFromArray(ac)
+	}
+	return ac
+}
+
 func (ac *arrayContainer) toBitmapContainer() *bitmapContainer {
 	bc := newBitmapContainer()
 	bc.loadData(ac)
@@ -246,6 +323,8 @@ func (ac *arrayContainer) or(a container) container {
 		return ac.orArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return a.or(ac)
+	case *runContainer:
+		return a.or(ac)
 	}
 	panic("should never happen")
 }
@@ -256,6 +335,8 @@ func (ac *arrayContainer) ior(a container) container {
 		return ac.orArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return a.ior(ac)
+	case *runContainer:
+		return a.or(ac)
 	}
 	panic("should never happen")
 }
@@ -266,6 +347,8 @@ func (ac *arrayContainer) lazyIOR(a container) container {
 		return ac.orArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return a.lazyIOR(ac)
+	case *runContainer:
+		return a.or(ac)
 	}
 	panic("should never happen")
 }
@@ -305,6 +388,8 @@ func (ac *arrayContainer) and(a container) container {
 		return ac.andArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return a.and(ac)
+	case *runContainer:
+		return a.and(ac)
 	}
 	panic("should never happen")
 }
@@ -315,20 +400,105 @@ func (ac *arrayContainer) intersects(a container) bool {
 		return ac.intersectsArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return a.intersects(ac)
+	case *runContainer:
+		return a.intersects(ac)
 	}
 	return false // should not happen
 }
 
+func (ac *arrayContainer) andCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer:
+		return intersection2by2Cardinality(ac.content, a.(*arrayContainer).content)
+	case *bitmapContainer:
+		return a.andCardinality(ac)
+	case *runContainer:
+		return a.andCardinality(ac)
+	}
+	panic("should never happen")
+}
+
+func (ac *arrayContainer) xorCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer:
+		return len(ac.content) + a.getCardinality() - 2*ac.andCardinality(a)
+	case *bitmapContainer:
+		return a.xorCardinality(ac)
+	case *runContainer:
+		return a.xorCardinality(ac)
+	}
+	panic("should never happen")
+}
+
+func (ac *arrayContainer) andNotCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer, *bitmapContainer, *runContainer:
+		return len(ac.content) - ac.andCardinality(a)
+	}
+	panic("should never happen")
+}
+
+func (ac *arrayContainer) isSubset(a container) bool {
+	if len(ac.content) > a.getCardinality() {
+		return false
+	}
+	switch a.(type) {
+	case *arrayContainer:
+		return subset2by2(ac.content, a.(*arrayContainer).content)
+	case *bitmapContainer:
+		for _, v := range ac.content {
+			if !a.contains(v) {
+				return false
+			}
+		}
+		return true
+	case *runContainer:
+		rc := a.(*runContainer)
+		i := 0
+		for _, v := range ac.content {
+			for i < len(rc.iv) && rc.iv[i].last() < int(v) {
+				i++
+			}
+			if i == len(rc.iv) || v < rc.iv[i].start {
+				return false
+			}
+		}
+		return true
+	}
+	panic("should never happen")
+}
+
 func (ac *arrayContainer) iand(a container) container {
 	switch a.(type) {
 	case *arrayContainer:
 		return ac.iandArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return ac.iandBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return ac.iandRun(a.(*runContainer))
 	}
 	panic("should never happen")
 }
 
+func (ac *arrayContainer) iandRun(rc *runContainer) *arrayContainer {
+	pos := 0
+	i := 0
+	for _, v := range ac.content {
+		for i < len(rc.iv) && rc.iv[i].last() < int(v) {
+			i++
+		}
+		if i == len(rc.iv) {
+			break
+		}
+		if v >= rc.iv[i].start {
+			ac.content[pos] = v
+			pos++
+		}
+	}
+	ac.content = ac.content[:pos]
+	return ac
+}
+
 func (ac *arrayContainer) iandBitmap(bc *bitmapContainer) *arrayContainer {
 	pos := 0
 	c := ac.getCardinality()
@@ -349,6 +519,8 @@ func (ac *arrayContainer) xor(a container) container {
 		return ac.xorArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return a.xor(ac)
+	case *runContainer:
+		return a.xor(ac)
 	}
 	panic("should never happen")
 }
@@ -388,6 +560,8 @@ func (ac *arrayContainer) andNot(a container) container {
 		return ac.andNotArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return ac.andNotBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return ac.andNotRun(a.(*runContainer))
 	}
 	panic("should never happen")
 }
@@ -398,6 +572,8 @@ func (ac *arrayContainer) iandNot(a container) container {
 		return ac.iandNotArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return ac.iandNotBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return ac.iandNotRun(a.(*runContainer))
 	}
 	panic("should never happen")
 }
@@ -447,6 +623,27 @@ func (ac *arrayContainer) andBitmap(value2 *bitmapContainer) container {
 	return answer
 }
 
+func (ac *arrayContainer) andNotRun(value2 *runContainer) container {
+	answer := ac.clone().(*arrayContainer)
+	return answer.iandNotRun(value2)
+}
+
+func (ac *arrayContainer) iandNotRun(value2 *runContainer) container {
+	pos := 0
+	i := 0
+	for _, v := range ac.content {
+		for i < len(value2.iv) && value2.iv[i].last() < int(v) {
+			i++
+		}
+		if i == len(value2.iv) || v < value2.iv[i].start {
+			ac.content[pos] = v
+			pos++
+		}
+	}
+	ac.content = ac.content[:pos]
+	return ac
+}
+
 func (ac *arrayContainer) iandNotBitmap(value2 *bitmapContainer) container {
 	pos := 0
 	for _, v := range ac.content {
@@ -542,7 +739,7 @@ func (ac *arrayContainer) negateRange(buffer []uint16, startIndex, lastIndex, st
 	}
 
 	for i, item := range buffer {
-		ac.content[i] = item
+		ac.content[startIndex+i] = item
 	}
 }
 
@@ -582,6 +779,86 @@ func (ac *arrayContainer) getCardinality() int {
 	return len(ac.content)
 }
 
+func (ac *arrayContainer) minimum() uint16 {
+	return ac.content[0]
+}
+
+func (ac *arrayContainer) maximum() uint16 {
+	return ac.content[len(ac.content)-1]
+}
+
+func (ac *arrayContainer) nextValue(x uint16) int {
+	i := binarySearch(ac.content, x)
+	if i < 0 {
+		i = -i - 1
+	}
+	if i == len(ac.content) {
+		return -1
+	}
+	return int(ac.content[i])
+}
+
+func (ac *arrayContainer) previousValue(x uint16) int {
+	i := binarySearch(ac.content, x)
+	if i < 0 {
+		i = -i - 2
+	}
+	if i < 0 {
+		return -1
+	}
+	return int(ac.content[i])
+}
+
+func (ac *arrayContainer) nextAbsentValue(x uint16) int {
+	i := binarySearch(ac.content, x)
+	v := int(x)
+	if i < 0 {
+		return v
+	}
+	for i < len(ac.content) && int(ac.content[i]) == v {
+		i++
+		v++
+	}
+	return v
+}
+
+func (ac *arrayContainer) previousAbsentValue(x uint16) int {
+	i := binarySearch(ac.content, x)
+	v := int(x)
+	if i < 0 {
+		return v
+	}
+	for i >= 0 && int(ac.content[i]) == v {
+		i--
+		v--
+	}
+	return v
+}
+
+// lowerBound returns the index of the first value >= x, with x up to maxCapacity
+func (ac *arrayContainer) lowerBound(x int) int {
+	if x >= maxCapacity {
+		return len(ac.content)
+	}
+	return advanceUntil(ac.content, -1, len(ac.content), uint16(x))
+}
+
+func (ac *arrayContainer) cardinalityInRange(start, end int) int {
+	return ac.lowerBound(end) - ac.lowerBound(start)
+}
+
+func (ac *arrayContainer) containsRange(start, end int) bool {
+	i := ac.lowerBound(start)
+	j := i + end - start - 1
+	// the values are distinct and sorted
+	return j < len(ac.content) && int(ac.content[i]) == start && int(ac.content[j]) == end-1
+}
+
+func (ac *arrayContainer) intersectsRange(start, end int) bool {
+	i := ac.lowerBound(start)
+	return i < len(ac.content) && int(ac.content[i]) < end
+}
+
 func (ac *arrayContainer) rank(x uint16) int {
 	answer := binarySearch(ac.content, x)
 	if answer >= 0 {
@@ -96,3 +96,32 @@ func TestArrayContainerMassiveSetAndGet(t *testing.T) {
 		}
 	}
 }
+
+func TestArrayContainerIaddRange(t *testing.T) {
+	// growing past the capacity must keep the values after the range
+	ac := &arrayContainer{[]uint16{1, 20}}
+	ac.iaddRange(5, 8)
+	if !reflect.DeepEqual(ac.content, []uint16{1, 5, 6, 7, 20}) {
+		t.Errorf("Bad iaddRange with reallocation: %v", ac.content)
+	}
+	ac = &arrayContainer{make([]uint16, 3, 10)}
+	copy(ac.content, []uint16{1, 6, 20})
+	ac.iaddRange(5, 8)
+	if !reflect.DeepEqual(ac.content, []uint16{1, 5, 6, 7, 20}) {
+		t.Errorf("Bad iaddRange in place: %v", ac.content)
+	}
+}
+
+func TestArrayContainerInot(t *testing.T) {
+	// the negated values go after the ones preceding the range
+	ac := &arrayContainer{[]uint16{1, 5, 10, 20}}
+	ac.inot(4, 12)
+	if !reflect.DeepEqual(ac.content, []uint16{1, 4, 6, 7, 8, 9, 11, 12, 20}) {
+		t.Errorf("Bad growing inot: %v", ac.content)
+	}
+	ac = &arrayContainer{[]uint16{1, 4, 6, 20}}
+	ac.inot(4, 6)
+	if !reflect.DeepEqual(ac.content, []uint16{1, 5, 20}) {
+		t.Errorf("Bad shrinking inot: %v", ac.content)
+	}
+}
@@ -510,3 +510,126 @@ func BenchmarkXorLopsided(b *testing.B) {
 		s.Clone().Xor(x2)
 	}
 }
+
+func BenchmarkNextManyRoaring(b *testing.B) {
+	b.StopTimer()
+	r := rand.New(rand.NewSource(0))
+	s := NewRoaringBitmap()
+	sz := 150000
+	initsize := 65000
+	for i := 0; i < initsize; i++ {
+		s.Add(uint32(r.Int31n(int32(sz))))
+	}
+	buf := make([]uint32, 256)
+	b.StartTimer()
+	for j := 0; j < b.N; j++ {
+		c = uint(0)
+		i := s.ManyIterator()
+		for n := i.NextMany(buf); n > 0; n = i.NextMany(buf) {
+			c += uint(n)
+		}
+	}
+}
+
+func BenchmarkIterateCallbackRoaring(b *testing.B) {
+	b.StopTimer()
+	r := rand.New(rand.NewSource(0))
+	s := NewRoaringBitmap()
+	sz := 150000
+	initsize := 65000
+	for i := 0; i < initsize; i++ {
+		s.Add(uint32(r.Int31n(int32(sz))))
+	}
+	b.StartTimer()
+	for j := 0; j < b.N; j++ {
+		c = uint(0)
+		s.Iterate(func(x uint32) bool {
+			c++
+			return true
+		})
+	}
+}
+
+func BenchmarkAddMany(b *testing.B) {
+	b.StopTimer()
+	r := rand.New(rand.NewSource(0))
+	dat := make([]uint32, 100000)
+	for i := range dat {
+		dat[i] = uint32(r.Int31n(1 << 22))
+	}
+	b.StartTimer()
+	for j := 0; j < b.N; j++ {
+		s := NewRoaringBitmap()
+		s.AddMany(dat)
+	}
+}
+
+func BenchmarkAddOneByOne(b *testing.B) {
+	b.StopTimer()
+	r := rand.New(rand.NewSource(0))
+	dat := make([]uint32, 100000)
+	for i := range dat {
+		dat[i] = uint32(r.Int31n(1 << 22))
+	}
+	b.StartTimer()
+	for j := 0; j < b.N; j++ {
+		s := NewRoaringBitmap()
+		for _, x := range dat {
+			s.Add(x)
+		}
+	}
+}
+
+func BenchmarkAddManySorted(b *testing.B) {
+	b.StopTimer()
+	dat := make([]uint32, 100000)
+	for i := range dat {
+		dat[i] = uint32(i * 41)
+	}
+	b.StartTimer()
+	for j := 0; j < b.N; j++ {
+		s := NewRoaringBitmap()
+		s.AddMany(dat)
+	}
+}
+
+func BenchmarkAddOneByOneSorted(b *testing.B) {
+	b.StopTimer()
+	dat := make([]uint32, 100000)
+	for i := range dat {
+		dat[i] = uint32(i * 41)
+	}
+	b.StartTimer()
+	for j := 0; j < b.N; j++ {
+		s := NewRoaringBitmap()
+		for _, x := range dat {
+			s.Add(x)
+		}
+	}
+}
+
+func BenchmarkBitmapWriter(b *testing.B) {
+	for j := 0; j < b.N; j++ {
+		w := NewBitmapWriter()
+		for i := 0; i < 100000; i++ {
+			w.Add(uint32(i * 41))
+		}
+		w.Bitmap()
+	}
+}
+
+func BenchmarkFastThreshold(b *testing.B) {
+	b.StopTimer()
+	r := rand.New(rand.NewSource(0))
+	bitmaps := make([]*RoaringBitmap, 20)
+	for i := range bitmaps {
+		bitmaps[i] = NewRoaringBitmap()
+		for j := 0; j < 100000; j++ {
+			bitmaps[i].Add(uint32(r.Int31n(1 << 22)))
+		}
+	}
+	b.StartTimer()
+	for j := 0; j < b.N; j++ {
+		FastThreshold(3, bitmaps...)
+	}
+}
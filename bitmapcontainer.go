@@ -1,5 +1,7 @@
 package roaring
 
+import "fmt"
+
 type bitmapContainer struct {
 	cardinality int
 	bitmap      []uint64
@@ -45,13 +47,41 @@ func (bcsi *bitmapContainerShortIterator) next() uint16 {
 func (bcsi *bitmapContainerShortIterator) hasNext() bool {
 	return bcsi.i >= 0
 }
+func (bcsi *bitmapContainerShortIterator) peekNext() uint16 {
+	return uint16(bcsi.i)
+}
+func (bcsi *bitmapContainerShortIterator) advanceIfNeeded(minval uint16) {
+	if bcsi.hasNext() && bcsi.i < int(minval) {
+		bcsi.i = bcsi.ptr.NextSetBit(int(minval))
+	}
+}
 func newBitmapContainerShortIterator(a *bitmapContainer) *bitmapContainerShortIterator {
 	return &bitmapContainerShortIterator{a, a.NextSetBit(0)}
 }
-func (bc *bitmapContainer) getShortIterator() shortIterable {
+func (bc *bitmapContainer) getShortIterator() shortPeekable {
 	return newBitmapContainerShortIterator(bc)
 }
 
+type reverseBitmapContainerShortIterator struct {
+	ptr *bitmapContainer
+	i   int
+}
+
+func (bcsi *reverseBitmapContainerShortIterator) next() uint16 {
+	j := bcsi.i
+	bcsi.i = bcsi.ptr.PrevSetBit(bcsi.i - 1)
+	return uint16(j)
+}
+func (bcsi *reverseBitmapContainerShortIterator) hasNext() bool {
+	return bcsi.i >= 0
+}
+func newReverseBitmapContainerShortIterator(a *bitmapContainer) *reverseBitmapContainerShortIterator {
+	return &reverseBitmapContainerShortIterator{a, a.PrevSetBit(len(a.bitmap)*64 - 1)}
+}
+func (bc *bitmapContainer) getReverseIterator() shortIterable {
+	return newReverseBitmapContainerShortIterator(bc)
+}
+
 func (bc *bitmapContainer) getSizeInBytes() int {
 	return len(bc.bitmap) * 8
 }
@@ -72,6 +102,52 @@ func bitmapEquals(a, b []uint64) bool {
 	return true
 }
 
+func (bc *bitmapContainer) iterate(hs uint32, f func(uint32) bool) bool {
+	for k, bitset := range bc.bitmap {
+		for bitset != 0 {
+			t := bitset & -bitset
+			if !f((uint32(k)*64 + uint32(popcount(t-1))) | hs) {
+				return false
+			}
+			bitset ^= t
+		}
+	}
+	return true
+}
+
+func (bc *bitmapContainer) nextRun(from int) (int, int) {
+	i := bc.NextSetBit(from)
+	if i < 0 {
+		return -1, -1
+	}
+	return i, bc.nextClearBit(i) - 1
+}
+
+// nextMany fills buf with the set bits from position cursor on
+func (bc *bitmapContainer) nextMany(hs uint32, buf []uint32, cursor int) (int, int) {
+	k := cursor / 64
+	if k >= len(bc.bitmap) {
+		return 0, cursor
+	}
+	bitset := bc.bitmap[k] >> uint(cursor%64) << uint(cursor%64)
+	n := 0
+	for n < len(buf) {
+		if bitset == 0 {
+			k++
+			if k == len(bc.bitmap) {
+				return n, k * 64
+			}
+			bitset = bc.bitmap[k]
+			continue
+		}
+		t := bitset & -bitset
+		buf[n] = (uint32(k)*64 + uint32(popcount(t-1))) | hs
+		n++
+		bitset ^= t
+	}
+	return n, k*64 + numberOfTrailingZeros(bitset)
+}
+
 func (bc *bitmapContainer) fillLeastSignificant16bits(x []uint32, i int, mask uint32) {
 	// TODO: should be written as optimized assembly
 	pos := i
@@ -87,6 +163,9 @@ func (bc *bitmapContainer) fillLeastSignificant16bits(x []uint32, i int, mask ui
 }
 
 func (bc *bitmapContainer) equals(o interface{}) bool {
+	if rc, ok := o.(*runContainer); ok {
+		return rc.equals(bc)
+	}
 	srb, ok := o.(*bitmapContainer)
 	if ok {
 		if srb.cardinality != bc.cardinality {
@@ -259,6 +338,8 @@ func (bc *bitmapContainer) or(a container) container {
 		return bc.orArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.orBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return a.(*runContainer).orBitmap(bc)
 	}
 	panic("should never happen")
 }
@@ -269,6 +350,8 @@ func (bc *bitmapContainer) ior(a container) container {
 		return bc.iorArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.iorBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return bc.iorRun(a.(*runContainer))
 	}
 	panic("should never happen")
 }
@@ -279,6 +362,8 @@ func (bc *bitmapContainer) lazyIOR(a container) container {
 		return bc.lazyIORArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.lazyIORBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return bc.lazyIORRun(a.(*runContainer))
 	}
 	panic("should never happen")
 }
@@ -334,6 +419,21 @@ func (bc *bitmapContainer) iorBitmap(value2 *bitmapContainer) container {
 	return answer
 }
 
+func (bc *bitmapContainer) iorRun(value2 *runContainer) container {
+	for _, iv := range value2.iv {
+		setBitmapRange(bc.bitmap, int(iv.start), iv.last()+1)
+	}
+	bc.computeCardinality()
+	return bc
+}
+
+func (bc *bitmapContainer) lazyIORRun(value2 *runContainer) container {
+	for _, iv := range value2.iv {
+		setBitmapRange(bc.bitmap, int(iv.start), iv.last()+1)
+	}
+	return bc
+}
+
 func (bc *bitmapContainer) lazyIORArray(value2 *arrayContainer) container {
 	answer := bc
 	c := value2.getCardinality()
@@ -359,6 +459,8 @@ func (bc *bitmapContainer) xor(a container) container {
 		return bc.xorArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.xorBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return a.(*runContainer).xorBitmap(bc)
 	}
 	panic("should never happen")
 }
@@ -380,6 +482,42 @@ func (bc *bitmapContainer) xorArray(value2 *arrayContainer) container {
 	return answer
 }
 
+func (bc *bitmapContainer) minimum() uint16 {
+	return uint16(bc.NextSetBit(0))
+}
+
+func (bc *bitmapContainer) maximum() uint16 {
+	return uint16(bc.PrevSetBit(maxCapacity - 1))
+}
+
+func (bc *bitmapContainer) nextValue(x uint16) int {
+	return bc.NextSetBit(int(x))
+}
+
+func (bc *bitmapContainer) previousValue(x uint16) int {
+	return bc.PrevSetBit(int(x))
+}
+
+func (bc *bitmapContainer) nextAbsentValue(x uint16) int {
+	return bc.nextClearBit(int(x))
+}
+
+func (bc *bitmapContainer) previousAbsentValue(x uint16) int {
+	return bc.prevClearBit(int(x))
+}
+
+func (bc *bitmapContainer) cardinalityInRange(start, end int) int {
+	return popcntBitmapRange(bc.bitmap, start, end)
+}
+
+func (bc *bitmapContainer) containsRange(start, end int) bool {
+	return containsBitmapRange(bc.bitmap, start, end)
+}
+
+func (bc *bitmapContainer) intersectsRange(start, end int) bool {
+	return intersectsBitmapRange(bc.bitmap, start, end)
+}
+
 func (bc *bitmapContainer) rank(x uint16) int {
 	// TODO: rewrite in assembly
 	leftover := (uint(x) + 1) & 63
@@ -425,6 +563,8 @@ func (bc *bitmapContainer) and(a container) container {
 		return bc.andArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.andBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return a.(*runContainer).andBitmap(bc)
 	}
 	panic("should never happen")
 }
@@ -435,6 +575,72 @@ func (bc *bitmapContainer) intersects(a container) bool {
 		return bc.intersectsArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.intersectsBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return a.(*runContainer).intersectsBitmap(bc)
+	}
+	panic("should never happen")
+}
+
+func (bc *bitmapContainer) andCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer:
+		answer := 0
+		for _, v := range a.(*arrayContainer).content {
+			if bc.contains(v) {
+				answer++
+			}
+		}
+		return answer
+	case *bitmapContainer:
+		return int(popcntAndSlice(bc.bitmap, a.(*bitmapContainer).bitmap))
+	case *runContainer:
+		return a.andCardinality(bc)
+	}
+	panic("should never happen")
+}
+
+func (bc *bitmapContainer) xorCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer, *runContainer:
+		return bc.cardinality + a.getCardinality() - 2*bc.andCardinality(a)
+	case *bitmapContainer:
+		return int(popcntXorSlice(bc.bitmap, a.(*bitmapContainer).bitmap))
+	}
+	panic("should never happen")
+}
+
+func (bc *bitmapContainer) andNotCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer, *runContainer:
+		return bc.cardinality - bc.andCardinality(a)
+	case *bitmapContainer:
+		return int(popcntMaskSlice(bc.bitmap, a.(*bitmapContainer).bitmap))
+	}
+	panic("should never happen")
+}
+
+func (bc *bitmapContainer) isSubset(a container) bool {
+	if bc.cardinality > a.getCardinality() {
+		return false
+	}
+	switch a.(type) {
+	case *bitmapContainer:
+		other := a.(*bitmapContainer).bitmap
+		for k, w := range bc.bitmap {
+			if w&^other[k] != 0 {
+				return false
+			}
+		}
+		return true
+	case *arrayContainer, *runContainer:
+		for i := bc.NextSetBit(0); i >= 0; {
+			end := bc.nextClearBit(i)
+			if !a.containsRange(i, end) {
+				return false
+			}
+			i = bc.NextSetBit(end)
+		}
+		return true
 	}
 	panic("should never happen")
 }
@@ -445,6 +651,8 @@ func (bc *bitmapContainer) iand(a container) container {
 		return bc.andArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.iandBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return bc.iandRun(a.(*runContainer))
 	}
 	panic("should never happen")
 }
@@ -478,6 +686,20 @@ func (bc *bitmapContainer) andBitmap(value2 *bitmapContainer) container {
 
 }
 
+func (bc *bitmapContainer) iandRun(value2 *runContainer) container {
+	start := 0
+	for _, iv := range value2.iv {
+		resetBitmapRange(bc.bitmap, start, int(iv.start))
+		start = iv.last() + 1
+	}
+	resetBitmapRange(bc.bitmap, start, maxCapacity)
+	bc.computeCardinality()
+	if bc.cardinality <= arrayDefaultMaxSize {
+		return bc.toArrayContainer()
+	}
+	return bc
+}
+
 func (bc *bitmapContainer) intersectsArray(value2 *arrayContainer) bool {
 	c := value2.getCardinality()
 	for k := 0; k < c; k++ {
@@ -521,6 +743,8 @@ func (bc *bitmapContainer) andNot(a container) container {
 		return bc.andNotArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.andNotBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return bc.andNotRun(a.(*runContainer))
 	}
 	panic("should never happen")
 }
@@ -531,6 +755,8 @@ func (bc *bitmapContainer) iandNot(a container) container {
 		return bc.andNotArray(a.(*arrayContainer))
 	case *bitmapContainer:
 		return bc.iandNotBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return bc.iandNotRun(a.(*runContainer))
 	}
 	panic("should never happen")
 }
@@ -567,6 +793,22 @@ func (bc *bitmapContainer) andNotBitmap(value2 *bitmapContainer) container {
 	return ac
 }
 
+func (bc *bitmapContainer) andNotRun(value2 *runContainer) container {
+	answer := bc.clone().(*bitmapContainer)
+	return answer.iandNotRun(value2)
+}
+
+func (bc *bitmapContainer) iandNotRun(value2 *runContainer) container {
+	for _, iv := range value2.iv {
+		resetBitmapRange(bc.bitmap, int(iv.start), iv.last()+1)
+	}
+	bc.computeCardinality()
+	if bc.cardinality <= arrayDefaultMaxSize {
+		return bc.toArrayContainer()
+	}
+	return bc
+}
+
 func (bc *bitmapContainer) iandNotBitmap(value2 *bitmapContainer) container {
 	newCardinality := int(popcntMaskSlice(bc.bitmap, value2.bitmap))
 	if newCardinality > arrayDefaultMaxSize {
@@ -597,6 +839,31 @@ func (bc *bitmapContainer) loadData(arrayContainer *arrayContainer) {
 	}
 }
 
+func (bc *bitmapContainer) validate() error {
+	if card := int(popcntSlice(bc.bitmap)); card != bc.cardinality {
+		return fmt.Errorf("%w: bitmap holds %d values, not %d", ErrCorrupt, card, bc.cardinality)
+	}
+	return nil
+}
+
+func (bc *bitmapContainer) numberOfRuns() int {
+	nr := 0
+	previous := uint64(0)
+	for _, w := range bc.bitmap {
+		// a run starts at every set bit whose predecessor is clear
+		nr += int(popcount(w &^ (w<<1 | previous>>63)))
+		previous = w
+	}
+	return nr
+}
+
+func (bc *bitmapContainer) toEfficientContainer() container {
+	if runContainerSerializedSizeInBytes(bc.numberOfRuns()) < bc.serializedSizeInBytes() {
+		return newRunContainerFromBitmap(bc)
+	}
+	return bc
+}
+
 func (bc *bitmapContainer) toArrayContainer() *arrayContainer {
 	ac := newArrayContainerCapacity(bc.cardinality)
 	ac.loadData(bc)
@@ -634,3 +901,69 @@ func (bc *bitmapContainer) NextSetBit(i int) int {
 	}
 	return -1
 }
+
+// PrevSetBit returns the largest set bit that is not larger than i, or -1
+func (bc *bitmapContainer) PrevSetBit(i int) int {
+	if i < 0 {
+		return -1
+	}
+	x := i / 64
+	if x >= len(bc.bitmap) {
+		x = len(bc.bitmap) - 1
+		i = x*64 + 63
+	}
+	w := bc.bitmap[x]
+	w = w << uint(63-i%64)
+	if w != 0 {
+		return i - numberOfLeadingZeros(w)
+	}
+	x--
+	for ; x >= 0; x-- {
+		if bc.bitmap[x] != 0 {
+			return (x * 64) + 63 - numberOfLeadingZeros(bc.bitmap[x])
+		}
+	}
+	return -1
+}
+
+// prevClearBit returns the largest clear bit that is not larger than i, or -1
+func (bc *bitmapContainer) prevClearBit(i int) int {
+	if i < 0 {
+		return -1
+	}
+	x := i / 64
+	if x >= len(bc.bitmap) {
+		return i
+	}
+	w := ^bc.bitmap[x]
+	w = w << uint(63-i%64)
+	if w != 0 {
+		return i - numberOfLeadingZeros(w)
+	}
+	x--
+	for ; x >= 0; x-- {
+		if bc.bitmap[x] != ^uint64(0) {
+			return (x * 64) + 63 - numberOfLeadingZeros(^bc.bitmap[x])
+		}
+	}
+	return -1
+}
+
+func (bc *bitmapContainer) nextClearBit(i int) int {
+	x := i / 64
+	if x >= len(bc.bitmap) {
+		return len(bc.bitmap) * 64
+	}
+	w := ^bc.bitmap[x]
+	w = w >> uint(i%64)
+	if w != 0 {
+		return i + numberOfTrailingZeros(w)
+	}
+	x++
+	for ; x < len(bc.bitmap); x++ {
+		if bc.bitmap[x] != ^uint64(0) {
+			return (x * 64) + numberOfTrailingZeros(^bc.bitmap[x])
+		}
+	}
+	return len(bc.bitmap) * 64
+}
@@ -0,0 +1,153 @@
+package bitmapindex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/tgruben/roaring"
+)
+
+func testBitmap(i int) *roaring.RoaringBitmap {
+	rb := roaring.BitmapOf(uint32(i), uint32(1000*i))
+	rb.AddRange(uint32(70000*i), uint32(70000*i+100*i+1))
+	return rb
+}
+
+func sameBitmap(t *testing.T, irb *roaring.ImmutableRoaringBitmap, err error, rb *roaring.RoaringBitmap) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Failed getting bitmap: %v", err)
+	}
+	if !irb.ToRoaringBitmap().Equals(rb) {
+		t.Fatalf("Bad bitmap")
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.rbi")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Failed creating: %v", err)
+	}
+	for i := 100; i > 0; i-- {
+		if err = w.Add(fmt.Sprintf("bitmap%d", i), testBitmap(i)); err != nil {
+			t.Fatalf("Failed adding: %v", err)
+		}
+		if err = w.AddID(uint64(i)<<40, testBitmap(i)); err != nil {
+			t.Fatalf("Failed adding: %v", err)
+		}
+	}
+	if err = w.Add("bitmap1", testBitmap(1)); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Duplicate name gave %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Failed closing: %v", err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed opening: %v", err)
+	}
+	defer r.Close()
+	if r.Len() != 200 {
+		t.Errorf("Bad length %d", r.Len())
+	}
+	for i := 1; i < r.Len(); i++ {
+		if r.Name(i-1) >= r.Name(i) {
+			t.Fatalf("Directory is not sorted")
+		}
+	}
+	for i := 1; i <= 100; i++ {
+		irb, err := r.Get(fmt.Sprintf("bitmap%d", i))
+		sameBitmap(t, irb, err, testBitmap(i))
+		irb, err = r.GetID(uint64(i) << 40)
+		sameBitmap(t, irb, err, testBitmap(i))
+	}
+	if _, err = r.Get("bitmap0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Missing name gave %v", err)
+	}
+	if _, err = r.GetID(0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Missing ID gave %v", err)
+	}
+}
+
+func TestReaderFormat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatalf("Failed creating: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Failed closing: %v", err)
+	}
+	r, err := NewReader(buf.Bytes())
+	if err != nil || r.Len() != 0 {
+		t.Fatalf("Failed reading an empty index: %v", err)
+	}
+	if _, err = NewReader(buf.Bytes()[1:]); !errors.Is(err, ErrFormat) {
+		t.Errorf("Bad magic gave %v", err)
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+	data[len(data)-footerSize] = 0xFF
+	if _, err = NewReader(data); !errors.Is(err, ErrFormat) {
+		t.Errorf("Bad directory offset gave %v", err)
+	}
+}
+
+func TestIndexGenerations(t *testing.T) {
+	dir := t.TempDir()
+	x, err := OpenIndex(dir)
+	if err != nil {
+		t.Fatalf("Failed opening: %v", err)
+	}
+	for gen := 0; gen < 3; gen++ {
+		bitmaps := make(map[string]*roaring.RoaringBitmap)
+		for i := gen * 10; i < gen*10+20; i++ {
+			bitmaps[fmt.Sprintf("bitmap%d", i)] = testBitmap(i + gen)
+		}
+		if err = x.Append(bitmaps); err != nil {
+			t.Fatalf("Failed appending: %v", err)
+		}
+	}
+	// bitmap i was last written by generation min(i/10, 2)
+	check := func(x *Index) {
+		for i := 0; i < 40; i++ {
+			gen := i / 10
+			if gen > 2 {
+				gen = 2
+			}
+			irb, err := x.Get(fmt.Sprintf("bitmap%d", i))
+			sameBitmap(t, irb, err, testBitmap(i+gen))
+		}
+		if _, err := x.Get("bitmap40"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Missing name gave %v", err)
+		}
+	}
+	check(x)
+	if x.Generations() != 3 {
+		t.Errorf("Bad number of generations %d", x.Generations())
+	}
+	if err = x.Merge(); err != nil {
+		t.Fatalf("Failed merging: %v", err)
+	}
+	if x.Generations() != 1 {
+		t.Errorf("Bad number of generations %d after merging", x.Generations())
+	}
+	check(x)
+	if err = x.Close(); err != nil {
+		t.Fatalf("Failed closing: %v", err)
+	}
+
+	x, err = OpenIndex(dir)
+	if err != nil {
+		t.Fatalf("Failed reopening: %v", err)
+	}
+	defer x.Close()
+	if x.Generations() != 1 {
+		t.Errorf("Bad number of generations %d after reopening", x.Generations())
+	}
+	check(x)
+}
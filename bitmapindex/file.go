@@ -0,0 +1,328 @@
+// Package bitmapindex stores many serialized roaring bitmaps in a single
+// file, looked up by name or by uint64 ID.
+//
+// A file holds a header, the bitmaps in the portable format written by
+// RoaringBitmap.WriteTo, the names, a directory sorted by name and a footer:
+//
+//	magic "RBIX", uint32 version
+//	bitmaps, each starting on an 8-byte boundary
+//	names
+//	directory: for each entry, uint64 name offset, uint64 bitmap offset,
+//	           uint64 bitmap length, uint32 name length, uint32 reserved
+//	footer: uint64 directory offset, uint64 entry count, uint32 version,
+//	        magic "RBIX"
+//
+// All integers are little-endian. Readers map the file in memory and
+// binary search the directory in place, so that opening a file does not
+// depend on its size, and bitmaps are returned as read-only
+// roaring.ImmutableRoaringBitmap views over the mapping.
+package bitmapindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/tgruben/roaring"
+)
+
+const (
+	magic         = "RBIX"
+	version       = 1
+	headerSize    = 8
+	entrySize     = 32
+	footerSize    = 24
+	bitmapAlign   = 8
+	idKeyByteSize = 8
+)
+
+var (
+	// ErrNotFound is returned when looking up a name that is not in the index
+	ErrNotFound = errors.New("bitmapindex: bitmap not found")
+	// ErrDuplicate is returned when adding a name twice to a Writer
+	ErrDuplicate = errors.New("bitmapindex: duplicate name")
+	// ErrFormat is returned when a file is not a valid index file
+	ErrFormat = errors.New("bitmapindex: invalid index file")
+)
+
+// IDName returns the name under which the bitmap with the given ID is
+// stored: the big-endian encoding of id, so that IDs sort numerically
+func IDName(id uint64) string {
+	var b [idKeyByteSize]byte
+	binary.BigEndian.PutUint64(b[:], id)
+	return string(b[:])
+}
+
+type entry struct {
+	name   string
+	offset uint64
+	length uint64
+}
+
+// Writer writes an index file. Bitmaps may be added in any order; the
+// directory is sorted when the Writer is closed.
+type Writer struct {
+	w       *bufio.Writer
+	closer  io.Closer
+	offset  uint64
+	entries []entry
+	names   map[string]bool
+}
+
+// NewWriter returns a Writer writing an index to w
+func NewWriter(w io.Writer) (*Writer, error) {
+	iw := &Writer{w: bufio.NewWriter(w), names: make(map[string]bool)}
+	var header [headerSize]byte
+	copy(header[:], magic)
+	binary.LittleEndian.PutUint32(header[4:], version)
+	if err := iw.write(header[:]); err != nil {
+		return nil, err
+	}
+	return iw, nil
+}
+
+// Create creates the index file at path, truncating any existing file
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	iw, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	iw.closer = f
+	return iw, nil
+}
+
+func (iw *Writer) write(b []byte) error {
+	n, err := iw.w.Write(b)
+	iw.offset += uint64(n)
+	return err
+}
+
+func (iw *Writer) align() error {
+	var pad [bitmapAlign]byte
+	return iw.write(pad[:(bitmapAlign-iw.offset%bitmapAlign)%bitmapAlign])
+}
+
+func (iw *Writer) addEntry(name string) error {
+	if iw.names[name] {
+		return fmt.Errorf("%w: %q", ErrDuplicate, name)
+	}
+	if err := iw.align(); err != nil {
+		return err
+	}
+	iw.names[name] = true
+	iw.entries = append(iw.entries, entry{name: name, offset: iw.offset})
+	return nil
+}
+
+// Add writes rb under name
+func (iw *Writer) Add(name string, rb *roaring.RoaringBitmap) error {
+	if err := iw.addEntry(name); err != nil {
+		return err
+	}
+	n, err := rb.WriteTo(iw.w)
+	iw.offset += uint64(n)
+	iw.entries[len(iw.entries)-1].length = uint64(n)
+	return err
+}
+
+// AddID writes rb under the name of id, see IDName
+func (iw *Writer) AddID(id uint64, rb *roaring.RoaringBitmap) error {
+	return iw.Add(IDName(id), rb)
+}
+
+// addSerialized writes an already serialized bitmap under name
+func (iw *Writer) addSerialized(name string, data []byte) error {
+	if err := iw.addEntry(name); err != nil {
+		return err
+	}
+	iw.entries[len(iw.entries)-1].length = uint64(len(data))
+	return iw.write(data)
+}
+
+// Close writes the names, the directory and the footer, then closes the
+// underlying file if the Writer was created with Create
+func (iw *Writer) Close() error {
+	err := iw.finish()
+	if iw.closer != nil {
+		if cerr := iw.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (iw *Writer) finish() error {
+	sort.Slice(iw.entries, func(i, j int) bool { return iw.entries[i].name < iw.entries[j].name })
+	nameOffsets := make([]uint64, len(iw.entries))
+	for i, e := range iw.entries {
+		nameOffsets[i] = iw.offset
+		if err := iw.write([]byte(e.name)); err != nil {
+			return err
+		}
+	}
+	if err := iw.align(); err != nil {
+		return err
+	}
+	directory := iw.offset
+	var record [entrySize]byte
+	for i, e := range iw.entries {
+		binary.LittleEndian.PutUint64(record[0:], nameOffsets[i])
+		binary.LittleEndian.PutUint64(record[8:], e.offset)
+		binary.LittleEndian.PutUint64(record[16:], e.length)
+		binary.LittleEndian.PutUint32(record[24:], uint32(len(e.name)))
+		if err := iw.write(record[:]); err != nil {
+			return err
+		}
+	}
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint64(footer[0:], directory)
+	binary.LittleEndian.PutUint64(footer[8:], uint64(len(iw.entries)))
+	binary.LittleEndian.PutUint32(footer[16:], version)
+	copy(footer[20:], magic)
+	if err := iw.write(footer[:]); err != nil {
+		return err
+	}
+	return iw.w.Flush()
+}
+
+// Reader gives access to the bitmaps of an index file
+type Reader struct {
+	data      []byte
+	directory []byte
+	count     int
+	unmap     func() error
+}
+
+// NewReader returns a Reader over an index held in memory; data must not
+// change while the Reader or the bitmaps it returns are in use
+func NewReader(data []byte) (*Reader, error) {
+	if len(data) < headerSize+footerSize ||
+		string(data[:4]) != magic || string(data[len(data)-4:]) != magic {
+		return nil, ErrFormat
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != version {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrFormat, v)
+	}
+	footer := data[len(data)-footerSize:]
+	directory := binary.LittleEndian.Uint64(footer[0:])
+	count := binary.LittleEndian.Uint64(footer[8:])
+	end := uint64(len(data) - footerSize)
+	if directory > end || count > (end-directory)/entrySize {
+		return nil, fmt.Errorf("%w: directory out of bounds", ErrFormat)
+	}
+	return &Reader{
+		data:      data,
+		directory: data[directory : directory+count*entrySize],
+		count:     int(count),
+	}, nil
+}
+
+// Open maps the index file at path in memory
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, unmap, err := mmapFile(f)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.unmap = unmap
+	return r, nil
+}
+
+// Close releases the mapping; the bitmaps returned by the Reader must not
+// be used afterwards
+func (r *Reader) Close() error {
+	if r.unmap == nil {
+		return nil
+	}
+	err := r.unmap()
+	r.unmap = nil
+	r.data = nil
+	r.directory = nil
+	r.count = 0
+	return err
+}
+
+// Len returns the number of bitmaps in the index
+func (r *Reader) Len() int {
+	return r.count
+}
+
+// Name returns the name of the ith bitmap, in sorted order
+func (r *Reader) Name(i int) string {
+	return string(r.name(i))
+}
+
+func (r *Reader) name(i int) []byte {
+	record := r.directory[i*entrySize:]
+	offset := binary.LittleEndian.Uint64(record[0:])
+	length := uint64(binary.LittleEndian.Uint32(record[24:]))
+	if offset > uint64(len(r.data)) || length > uint64(len(r.data))-offset {
+		return nil
+	}
+	return r.data[offset : offset+length]
+}
+
+// serialized returns the bytes of the ith bitmap
+func (r *Reader) serialized(i int) ([]byte, error) {
+	record := r.directory[i*entrySize:]
+	offset := binary.LittleEndian.Uint64(record[8:])
+	length := binary.LittleEndian.Uint64(record[16:])
+	if offset > uint64(len(r.data)) || length > uint64(len(r.data))-offset {
+		return nil, fmt.Errorf("%w: bitmap %d out of bounds", ErrFormat, i)
+	}
+	return r.data[offset : offset+length : offset+length], nil
+}
+
+// At returns a read-only view of the ith bitmap, in sorted order
+func (r *Reader) At(i int) (*roaring.ImmutableRoaringBitmap, error) {
+	data, err := r.serialized(i)
+	if err != nil {
+		return nil, err
+	}
+	return roaring.NewImmutableRoaringBitmap(data)
+}
+
+// index returns the position of name in the directory, or -1
+func (r *Reader) index(name string) int {
+	key := []byte(name)
+	i := sort.Search(r.count, func(i int) bool { return bytes.Compare(r.name(i), key) >= 0 })
+	if i < r.count && bytes.Equal(r.name(i), key) {
+		return i
+	}
+	return -1
+}
+
+// Get returns a read-only view of the bitmap stored under name, or
+// ErrNotFound
+func (r *Reader) Get(name string) (*roaring.ImmutableRoaringBitmap, error) {
+	i := r.index(name)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return r.At(i)
+}
+
+// GetID returns a read-only view of the bitmap stored under id, or
+// ErrNotFound
+func (r *Reader) GetID(id uint64) (*roaring.ImmutableRoaringBitmap, error) {
+	return r.Get(IDName(id))
+}
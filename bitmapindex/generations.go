@@ -0,0 +1,194 @@
+package bitmapindex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tgruben/roaring"
+)
+
+const generationSuffix = ".rbi"
+
+type generation struct {
+	seq  uint64
+	path string
+	*Reader
+}
+
+// Index is a directory of index files, or generations. Bitmaps are added
+// by appending a new generation, and a bitmap in a newer generation
+// replaces the bitmap of the same name in older ones. Merge rewrites all
+// generations into one. An Index must not be modified concurrently.
+type Index struct {
+	dir         string
+	generations []generation // oldest first
+}
+
+// OpenIndex opens all the generations found in dir
+func OpenIndex(dir string) (*Index, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	x := &Index{dir: dir}
+	for _, fi := range files {
+		name := fi.Name()
+		if !strings.HasSuffix(name, generationSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, generationSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		g := generation{seq: seq, path: filepath.Join(dir, name)}
+		g.Reader, err = Open(g.path)
+		if err != nil {
+			x.Close()
+			return nil, err
+		}
+		x.generations = append(x.generations, g)
+	}
+	sort.Slice(x.generations, func(i, j int) bool { return x.generations[i].seq < x.generations[j].seq })
+	return x, nil
+}
+
+// Close closes all the generations
+func (x *Index) Close() error {
+	var err error
+	for _, g := range x.generations {
+		if cerr := g.Close(); err == nil {
+			err = cerr
+		}
+	}
+	x.generations = nil
+	return err
+}
+
+// Generations returns the number of generations in the index
+func (x *Index) Generations() int {
+	return len(x.generations)
+}
+
+// Get returns a read-only view of the newest bitmap stored under name, or
+// ErrNotFound
+func (x *Index) Get(name string) (*roaring.ImmutableRoaringBitmap, error) {
+	for i := len(x.generations) - 1; i >= 0; i-- {
+		if j := x.generations[i].index(name); j >= 0 {
+			return x.generations[i].At(j)
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+}
+
+// GetID returns a read-only view of the newest bitmap stored under id, or
+// ErrNotFound
+func (x *Index) GetID(id uint64) (*roaring.ImmutableRoaringBitmap, error) {
+	return x.Get(IDName(id))
+}
+
+func (x *Index) nextSeq() uint64 {
+	if len(x.generations) == 0 {
+		return 1
+	}
+	return x.generations[len(x.generations)-1].seq + 1
+}
+
+// create writes a new generation with fill, renaming it into place only
+// once it is complete, and opens it
+func (x *Index) create(fill func(w *Writer) error) (generation, error) {
+	g := generation{seq: x.nextSeq()}
+	g.path = filepath.Join(x.dir, fmt.Sprintf("%08d%s", g.seq, generationSuffix))
+	tmp := g.path + ".tmp"
+	w, err := Create(tmp)
+	if err != nil {
+		return g, err
+	}
+	err = fill(w)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, g.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return g, err
+	}
+	g.Reader, err = Open(g.path)
+	return g, err
+}
+
+// Append writes bitmaps as a new generation
+func (x *Index) Append(bitmaps map[string]*roaring.RoaringBitmap) error {
+	g, err := x.create(func(w *Writer) error {
+		for name, rb := range bitmaps {
+			if err := w.Add(name, rb); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	x.generations = append(x.generations, g)
+	return nil
+}
+
+// Merge rewrites all the generations as a single one holding the newest
+// bitmap of each name, then removes the older files
+func (x *Index) Merge() error {
+	if len(x.generations) < 2 {
+		return nil
+	}
+	g, err := x.create(func(w *Writer) error {
+		// the directories are sorted, so we merge them; for each name, we
+		// copy the serialized bitmap of the newest generation holding it
+		pos := make([]int, len(x.generations))
+		for {
+			newest := -1
+			var name []byte
+			for i := len(x.generations) - 1; i >= 0; i-- {
+				if pos[i] == x.generations[i].Len() {
+					continue
+				}
+				n := x.generations[i].name(pos[i])
+				if newest < 0 || string(n) < string(name) {
+					newest, name = i, n
+				}
+			}
+			if newest < 0 {
+				return nil
+			}
+			data, err := x.generations[newest].serialized(pos[newest])
+			if err != nil {
+				return err
+			}
+			if err = w.addSerialized(string(name), data); err != nil {
+				return err
+			}
+			for i := range x.generations {
+				if pos[i] < x.generations[i].Len() && string(x.generations[i].name(pos[i])) == string(name) {
+					pos[i]++
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	old := x.generations
+	x.generations = []generation{g}
+	for _, o := range old {
+		o.Close()
+		if rerr := os.Remove(o.path); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
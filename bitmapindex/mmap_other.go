@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd) || appengine
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd appengine
+
+package bitmapindex
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// mmapFile reads f in memory where memory mapping is not available
+func mmapFile(f *os.File) ([]byte, func() error, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,27 @@
+//go:build (linux || darwin || dragonfly || freebsd || netbsd || openbsd) && !appengine
+// +build linux darwin dragonfly freebsd netbsd openbsd
+// +build !appengine
+
+package bitmapindex
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps f read-only in memory and returns the mapping along with
+// the function releasing it
+func mmapFile(f *os.File) ([]byte, func() error, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.Size() == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
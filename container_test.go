@@ -129,3 +129,41 @@ func TestRoaringContainer(t *testing.T) {
 	})
 
 }
+
+func TestReverseShortIterators(t *testing.T) {
+	Convey("NumberOfLeadingZeros", t, func() {
+		So(numberOfLeadingZeros(0), ShouldEqual, 64)
+		So(numberOfLeadingZeros(1), ShouldEqual, 63)
+		So(numberOfLeadingZeros(1<<40|1<<3), ShouldEqual, 23)
+		So(numberOfLeadingZeros(1<<63), ShouldEqual, 0)
+	})
+	Convey("PrevSetBit", t, func() {
+		bc := newBitmapContainer()
+		bc.add(0)
+		bc.add(63)
+		bc.add(64)
+		bc.add(1000)
+		So(bc.PrevSetBit(65535), ShouldEqual, 1000)
+		So(bc.PrevSetBit(999), ShouldEqual, 64)
+		So(bc.PrevSetBit(64), ShouldEqual, 64)
+		So(bc.PrevSetBit(62), ShouldEqual, 0)
+		So(bc.PrevSetBit(-1), ShouldEqual, -1)
+	})
+	Convey("reverse iterators of all container types", t, func() {
+		content := []uint16{0, 1, 2, 3, 63, 64, 100, 101, 1000, 65534, 65535}
+		ac := makeContainer(content).(*arrayContainer)
+		for _, c := range []container{ac, ac.toBitmapContainer(), newRunContainerFromArray(ac)} {
+			si := c.getReverseIterator()
+			i := len(content) - 1
+			for si.hasNext() {
+				So(i, ShouldBeGreaterThanOrEqualTo, 0)
+				So(si.next(), ShouldEqual, content[i])
+				i--
+			}
+			So(i, ShouldEqual, -1)
+		}
+		So(newArrayContainer().getReverseIterator().hasNext(), ShouldBeFalse)
+		So(newBitmapContainer().getReverseIterator().hasNext(), ShouldBeFalse)
+		So(newRunContainer().getReverseIterator().hasNext(), ShouldBeFalse)
+	})
+}
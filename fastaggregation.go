@@ -2,6 +2,7 @@ package roaring
 
 import (
 	"container/heap"
+	"math/bits"
 	"sort"
 )
 
@@ -44,7 +45,7 @@ func FastHorizontalOr(bitmaps ...*RoaringBitmap) *RoaringBitmap {
 	heap.Init(&pq)
 	for pq.Len() > 0 {
 		x1 := heap.Pop(&pq).(*containeritem)
-		thiscontainer := x1.value.highlowcontainer.getContainerAtIndex(x1.keyindex)
+		thiscontainer := x1.value.highlowcontainer.getContainerAtIndex(x1.keyindex).clone()
 		thiskey := x1.value.highlowcontainer.getKeyAtIndex(x1.keyindex)
 		x1.keyindex++
 		if x1.keyindex < x1.value.highlowcontainer.size() {
@@ -68,6 +69,123 @@ func FastHorizontalOr(bitmaps ...*RoaringBitmap) *RoaringBitmap {
 	return answer
 }
 
+// FastThreshold computes the integers that belong to at least t of the
+// bitmaps, t smaller than 1 being treated as 1. Like FastHorizontalOr, it
+// processes one key at a time, and counts the occurrences of the integers of
+// each key in bit-sliced counters over the words of a bitmap container.
+func FastThreshold(t int, bitmaps ...*RoaringBitmap) *RoaringBitmap {
+	if t <= 1 {
+		return FastHorizontalOr(bitmaps...)
+	}
+	answer := NewRoaringBitmap()
+	if t > len(bitmaps) {
+		return answer
+	}
+	pq := make(containerPriorityQueue, 0, len(bitmaps))
+	for _, bm := range bitmaps {
+		if bm.GetCardinality() > 0 {
+			pq = append(pq, &containeritem{bm, 0, len(pq)})
+		}
+	}
+	heap.Init(&pq)
+	// counters[b][k] holds bit b of the counts of the integers of word k
+	counters := make([][]uint64, bits.Len(uint(len(bitmaps))))
+	for b := range counters {
+		counters[b] = make([]uint64, maxCapacity/64)
+	}
+	containers := make([]container, 0, len(bitmaps))
+	for pq.Len() > 0 {
+		thiskey := pq[0].value.highlowcontainer.getKeyAtIndex(pq[0].keyindex)
+		containers = containers[:0]
+		for pq.Len() > 0 && pq[0].value.highlowcontainer.getKeyAtIndex(pq[0].keyindex) == thiskey {
+			x := heap.Pop(&pq).(*containeritem)
+			containers = append(containers, x.value.highlowcontainer.getContainerAtIndex(x.keyindex))
+			x.keyindex++
+			if x.keyindex < x.value.highlowcontainer.size() {
+				heap.Push(&pq, x)
+			}
+		}
+		if len(containers) < t {
+			continue
+		}
+		for b := range counters {
+			fill(counters[b], 0)
+		}
+		for _, c := range containers {
+			countContainer(counters, c)
+		}
+		bc := newBitmapContainer()
+		for k := range bc.bitmap {
+			bc.bitmap[k] = countersAtLeast(counters, k, t)
+		}
+		bc.computeCardinality()
+		if bc.cardinality == 0 {
+			continue
+		}
+		if bc.cardinality <= arrayDefaultMaxSize {
+			answer.highlowcontainer.appendContainer(thiskey, bc.toArrayContainer())
+		} else {
+			answer.highlowcontainer.appendContainer(thiskey, bc)
+		}
+	}
+	return answer
+}
+
+// incrementCounters adds one to the counts of the integers of word k that
+// are set in w, carrying over the bit slices
+func incrementCounters(counters [][]uint64, k int, w uint64) {
+	for b := 0; w != 0 && b < len(counters); b++ {
+		carry := counters[b][k] & w
+		counters[b][k] ^= w
+		w = carry
+	}
+}
+
+// countContainer adds one to the counts of the integers of c
+func countContainer(counters [][]uint64, c container) {
+	switch c.(type) {
+	case *arrayContainer:
+		for _, v := range c.(*arrayContainer).content {
+			incrementCounters(counters, int(v/64), uint64(1)<<(v%64))
+		}
+	case *bitmapContainer:
+		for k, w := range c.(*bitmapContainer).bitmap {
+			incrementCounters(counters, k, w)
+		}
+	case *runContainer:
+		for _, iv := range c.(*runContainer).iv {
+			start, last := int(iv.start), iv.last()
+			for k := start / 64; k <= last/64; k++ {
+				w := ^uint64(0)
+				if k == start/64 {
+					w &= ^uint64(0) << uint(start%64)
+				}
+				if k == last/64 {
+					w &= ^uint64(0) >> uint(63-last%64)
+				}
+				incrementCounters(counters, k, w)
+			}
+		}
+	default:
+		panic("should never happen")
+	}
+}
+
+// countersAtLeast returns the bits of word k whose count is at least t,
+// comparing the bit slices from the most significant one
+func countersAtLeast(counters [][]uint64, k int, t int) uint64 {
+	greater, equal := uint64(0), ^uint64(0)
+	for b := len(counters) - 1; b >= 0; b-- {
+		if t>>uint(b)&1 == 1 {
+			equal &= counters[b][k]
+		} else {
+			greater |= equal & counters[b][k]
+			equal &^= counters[b][k]
+		}
+	}
+	return greater | equal
+}
+
 // FastOr computes the union between many bitmaps quickly (see also FastHorizontalOr)
 func FastOr(bitmaps ...*RoaringBitmap) *RoaringBitmap {
 	// Todo: we really want a port of horizontal_or (see https://github.com/lemire/RoaringBitmap/blob/master/src/main/java/org/roaringbitmap/FastAggregation.java#L84-L126 ) for better speed
@@ -5,6 +5,7 @@ package roaring
 import (
 	"container/heap"
 	. "github.com/smartystreets/goconvey/convey"
+	"math/rand"
 	"testing"
 )
 
@@ -164,3 +165,43 @@ func TestFastAggregationsXOR(t *testing.T) {
 		So(FastXor(rb1, rb2, rb3).Equals(bigxor), ShouldEqual, true)
 	})
 }
+
+func TestFastThreshold(t *testing.T) {
+	Convey("Threshold", t, func() {
+		r := rand.New(rand.NewSource(26))
+		var bitmaps []*RoaringBitmap
+		counts := make(map[uint32]int)
+		for i := 0; i < 20; i++ {
+			rb := NewRoaringBitmap()
+			for j := 0; j < 2000; j++ {
+				rb.AddInt(r.Intn(1 << 18))
+			}
+			for j := 0; j < 20000+1000*i; j++ {
+				rb.AddInt(1<<18 + r.Intn(1<<16))
+			}
+			start := uint32(r.Intn(1 << 19))
+			rb.AddRange(start, start+uint32(r.Intn(1<<17)))
+			if i%3 == 0 {
+				rb.RunOptimize()
+			}
+			for _, x := range rb.ToArray() {
+				counts[x]++
+			}
+			bitmaps = append(bitmaps, rb)
+		}
+		for _, threshold := range []int{-1, 1, 2, 3, 7, 19, 20, 21} {
+			expected := NewRoaringBitmap()
+			for x, c := range counts {
+				if c >= threshold {
+					expected.Add(x)
+				}
+			}
+			So(FastThreshold(threshold, bitmaps...).Equals(expected), ShouldBeTrue)
+		}
+		So(FastThreshold(20, bitmaps...).Equals(FastAnd(bitmaps...)), ShouldBeTrue)
+		So(FastThreshold(1, bitmaps...).Equals(FastOr(bitmaps...)), ShouldBeTrue)
+		So(FastThreshold(2).IsEmpty(), ShouldBeTrue)
+		So(FastThreshold(2, bitmaps[0], bitmaps[0]).Equals(bitmaps[0]), ShouldBeTrue)
+		So(FastThreshold(2, BitmapOf(1, 2, 70000), BitmapOf(2, 3, 70000), BitmapOf(3)).ToArray(), ShouldResemble, []uint32{2, 3, 70000})
+	})
+}
@@ -0,0 +1,326 @@
+package roaring
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ImmutableRoaringBitmap is a read-only view over a bitmap serialized with
+// WriteTo, typically held in a memory-mapped file. Opening a view only reads
+// the fixed-size part of the header: keys are binary searched in place and
+// containers are decoded, aliasing the buffer where the platform allows it,
+// when an operation needs them. The buffer must not change while the view
+// or any result derived from it is in use.
+type ImmutableRoaringBitmap struct {
+	data    []byte
+	size    int
+	isRun   []byte // bitset marking the run containers, nil without runs
+	keycard []byte // key and cardinality minus one of each container
+	offsets []byte // start of each container
+}
+
+// NewImmutableRoaringBitmap creates a view over the serialized bitmap in
+// data. Only the header is checked, so that opening a large bitmap takes
+// constant time; call Validate before trusting data from an untrusted source.
+func NewImmutableRoaringBitmap(data []byte) (*ImmutableRoaringBitmap, error) {
+	irb := &ImmutableRoaringBitmap{data: data}
+	if len(data) < 4 {
+		return nil, ErrTruncated
+	}
+	cookie := binary.LittleEndian.Uint32(data)
+	offset := 4
+	if cookie&0x0000FFFF == serial_cookie_run {
+		irb.size = int(cookie>>16) + 1
+		n := (irb.size + 7) / 8
+		if len(data) < offset+n {
+			return nil, ErrTruncated
+		}
+		irb.isRun = data[offset : offset+n]
+		offset += n
+	} else if cookie == serial_cookie {
+		if len(data) < offset+4 {
+			return nil, ErrTruncated
+		}
+		size := binary.LittleEndian.Uint32(data[offset:])
+		if size > maxCapacity {
+			return nil, fmt.Errorf("%w: %d containers", ErrCorrupt, size)
+		}
+		irb.size = int(size)
+		offset += 4
+	} else {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidCookie, cookie)
+	}
+	if len(data) < offset+4*irb.size {
+		return nil, ErrTruncated
+	}
+	irb.keycard = data[offset : offset+4*irb.size]
+	offset += 4 * irb.size
+	if irb.isRun == nil || irb.size >= no_offset_threshold {
+		if len(data) < offset+4*irb.size {
+			return nil, ErrTruncated
+		}
+		irb.offsets = data[offset : offset+4*irb.size]
+		return irb, nil
+	}
+	// small bitmaps with runs omit the offsets, we recompute them
+	irb.offsets = make([]byte, 4*irb.size)
+	for i := 0; i < irb.size; i++ {
+		binary.LittleEndian.PutUint32(irb.offsets[4*i:], uint32(offset))
+		var err error
+		_, offset, err = containerFromBuffer(data, offset, irb.cardinality(i), irb.isRunContainer(i))
+		if err != nil {
+			return nil, fmt.Errorf("container %d: %w", i, err)
+		}
+	}
+	return irb, nil
+}
+
+// Validate checks every container of the view, returning ErrTruncated or
+// ErrCorrupt if the buffer does not hold a well-formed bitmap
+func (irb *ImmutableRoaringBitmap) Validate() error {
+	for i := 0; i < irb.size; i++ {
+		if i > 0 && irb.key(i) <= irb.key(i-1) {
+			return fmt.Errorf("%w: keys are not strictly increasing at container %d", ErrCorrupt, i)
+		}
+		offset := int(binary.LittleEndian.Uint32(irb.offsets[4*i:]))
+		c, _, err := containerFromBuffer(irb.data, offset, irb.cardinality(i), irb.isRunContainer(i))
+		if err != nil {
+			return fmt.Errorf("container %d: %w", i, err)
+		}
+		if err = validateContainer(i, c, irb.cardinality(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (irb *ImmutableRoaringBitmap) key(i int) uint16 {
+	return binary.LittleEndian.Uint16(irb.keycard[4*i:])
+}
+
+func (irb *ImmutableRoaringBitmap) cardinality(i int) int {
+	return int(binary.LittleEndian.Uint16(irb.keycard[4*i+2:])) + 1
+}
+
+func (irb *ImmutableRoaringBitmap) isRunContainer(i int) bool {
+	return irb.isRun != nil && irb.isRun[i/8]&(1<<(uint(i)%8)) != 0
+}
+
+// container decodes container i; the result aliases the buffer and must
+// be cloned before being modified or handed out
+func (irb *ImmutableRoaringBitmap) container(i int) container {
+	offset := int(binary.LittleEndian.Uint32(irb.offsets[4*i:]))
+	c, _, err := containerFromBuffer(irb.data, offset, irb.cardinality(i), irb.isRunContainer(i))
+	if err != nil {
+		panic(fmt.Errorf("container %d: %w", i, err))
+	}
+	return c
+}
+
+// getIndex returns the index of the container with key x, or -(insertion
+// point)-1 when there is none
+func (irb *ImmutableRoaringBitmap) getIndex(x uint16) int {
+	low := 0
+	high := irb.size - 1
+	for low <= high {
+		middleIndex := int(uint(low+high) >> 1)
+		middleValue := irb.key(middleIndex)
+		if middleValue < x {
+			low = middleIndex + 1
+		} else if middleValue > x {
+			high = middleIndex - 1
+		} else {
+			return middleIndex
+		}
+	}
+	return -(low + 1)
+}
+
+// IsEmpty returns true if the bitmap is empty
+func (irb *ImmutableRoaringBitmap) IsEmpty() bool {
+	return irb.size == 0
+}
+
+// GetCardinality returns the number of integers contained in the bitmap,
+// reading only the header
+func (irb *ImmutableRoaringBitmap) GetCardinality() uint64 {
+	size := uint64(0)
+	for i := 0; i < irb.size; i++ {
+		size += uint64(irb.cardinality(i))
+	}
+	return size
+}
+
+// Contains returns true if the integer is contained in the bitmap
+func (irb *ImmutableRoaringBitmap) Contains(x uint32) bool {
+	i := irb.getIndex(highbits(x))
+	return i >= 0 && irb.container(i).contains(lowbits(x))
+}
+
+// Rank returns the number of integers that are smaller or equal to x
+func (irb *ImmutableRoaringBitmap) Rank(x uint32) uint32 {
+	size := uint32(0)
+	for i := 0; i < irb.size; i++ {
+		key := irb.key(i)
+		if key > highbits(x) {
+			return size
+		}
+		if key < highbits(x) {
+			size += uint32(irb.cardinality(i))
+		} else {
+			return size + uint32(irb.container(i).rank(lowbits(x)))
+		}
+	}
+	return size
+}
+
+// Select returns the xth integer in the bitmap
+func (irb *ImmutableRoaringBitmap) Select(x uint32) (uint32, error) {
+	remaining := x
+	for i := 0; i < irb.size; i++ {
+		card := uint32(irb.cardinality(i))
+		if remaining >= card {
+			remaining -= card
+		} else {
+			return uint32(irb.key(i))<<16 + uint32(irb.container(i).selectInt(uint16(remaining))), nil
+		}
+	}
+	return 0, fmt.Errorf("Can't find %dth integer in a bitmap with only %d items", x, irb.GetCardinality())
+}
+
+type immutableIntIterator struct {
+	pos  int
+	hs   uint32
+	iter shortIterable
+	irb  *ImmutableRoaringBitmap
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (ii *immutableIntIterator) HasNext() bool {
+	return ii.pos < ii.irb.size
+}
+
+func (ii *immutableIntIterator) init() {
+	if ii.irb.size > ii.pos {
+		ii.iter = ii.irb.container(ii.pos).getShortIterator()
+		ii.hs = toIntUnsigned(ii.irb.key(ii.pos)) << 16
+	}
+}
+
+// Next returns the next integer
+func (ii *immutableIntIterator) Next() uint32 {
+	x := toIntUnsigned(ii.iter.next()) | ii.hs
+	if !ii.iter.hasNext() {
+		ii.pos = ii.pos + 1
+		ii.init()
+	}
+	return x
+}
+
+// Iterator creates a new IntIterable to iterate over the integers contained in the bitmap, in sorted order
+func (irb *ImmutableRoaringBitmap) Iterator() IntIterable {
+	p := &immutableIntIterator{irb: irb}
+	p.init()
+	return p
+}
+
+// ToRoaringBitmap copies the view into a new, modifiable RoaringBitmap
+func (irb *ImmutableRoaringBitmap) ToRoaringBitmap() *RoaringBitmap {
+	answer := NewRoaringBitmap()
+	for i := 0; i < irb.size; i++ {
+		answer.highlowcontainer.appendContainer(irb.key(i), irb.container(i).clone())
+	}
+	return answer
+}
+
+// And computes the intersection between two bitmaps and returns the result
+func (irb *ImmutableRoaringBitmap) And(x2 *ImmutableRoaringBitmap) *RoaringBitmap {
+	answer := NewRoaringBitmap()
+	pos1 := 0
+	pos2 := 0
+	for pos1 < irb.size && pos2 < x2.size {
+		s1 := irb.key(pos1)
+		s2 := x2.key(pos2)
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			c := irb.container(pos1).and(x2.container(pos2))
+			if c.getCardinality() > 0 {
+				answer.highlowcontainer.appendContainer(s1, c)
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return answer
+}
+
+// Or computes the union between two bitmaps and returns the result
+func (irb *ImmutableRoaringBitmap) Or(x2 *ImmutableRoaringBitmap) *RoaringBitmap {
+	answer := NewRoaringBitmap()
+	pos1 := 0
+	pos2 := 0
+	for pos1 < irb.size || pos2 < x2.size {
+		if pos2 == x2.size || (pos1 < irb.size && irb.key(pos1) < x2.key(pos2)) {
+			answer.highlowcontainer.appendContainer(irb.key(pos1), irb.container(pos1).clone())
+			pos1++
+		} else if pos1 == irb.size || irb.key(pos1) > x2.key(pos2) {
+			answer.highlowcontainer.appendContainer(x2.key(pos2), x2.container(pos2).clone())
+			pos2++
+		} else {
+			answer.highlowcontainer.appendContainer(irb.key(pos1), irb.container(pos1).or(x2.container(pos2)))
+			pos1++
+			pos2++
+		}
+	}
+	return answer
+}
+
+// Xor computes the symmetric difference between two bitmaps and returns the result
+func (irb *ImmutableRoaringBitmap) Xor(x2 *ImmutableRoaringBitmap) *RoaringBitmap {
+	answer := NewRoaringBitmap()
+	pos1 := 0
+	pos2 := 0
+	for pos1 < irb.size || pos2 < x2.size {
+		if pos2 == x2.size || (pos1 < irb.size && irb.key(pos1) < x2.key(pos2)) {
+			answer.highlowcontainer.appendContainer(irb.key(pos1), irb.container(pos1).clone())
+			pos1++
+		} else if pos1 == irb.size || irb.key(pos1) > x2.key(pos2) {
+			answer.highlowcontainer.appendContainer(x2.key(pos2), x2.container(pos2).clone())
+			pos2++
+		} else {
+			c := irb.container(pos1).xor(x2.container(pos2))
+			if c.getCardinality() > 0 {
+				answer.highlowcontainer.appendContainer(irb.key(pos1), c)
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return answer
+}
+
+// AndNot computes the difference between two bitmaps and returns the result
+func (irb *ImmutableRoaringBitmap) AndNot(x2 *ImmutableRoaringBitmap) *RoaringBitmap {
+	answer := NewRoaringBitmap()
+	pos1 := 0
+	pos2 := 0
+	for pos1 < irb.size {
+		if pos2 == x2.size || irb.key(pos1) < x2.key(pos2) {
+			answer.highlowcontainer.appendContainer(irb.key(pos1), irb.container(pos1).clone())
+			pos1++
+		} else if irb.key(pos1) > x2.key(pos2) {
+			pos2++
+		} else {
+			c := irb.container(pos1).andNot(x2.container(pos2))
+			if c.getCardinality() > 0 {
+				answer.highlowcontainer.appendContainer(irb.key(pos1), c)
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return answer
+}
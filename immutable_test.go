@@ -0,0 +1,190 @@
+package roaring
+
+// to run just these tests: go test -run TestImmutable*
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// randomMixedBitmap returns a bitmap holding array, bitmap and run containers
+func randomMixedBitmap(r *rand.Rand, containers int) *RoaringBitmap {
+	rb := NewRoaringBitmap()
+	for i := 0; i < containers; i++ {
+		base := r.Intn(64) << 16
+		switch r.Intn(3) {
+		case 0:
+			for j := 0; j < 1+r.Intn(100); j++ {
+				rb.AddInt(base + r.Intn(1<<16))
+			}
+		case 1:
+			for j := 0; j < 10000; j++ {
+				rb.AddInt(base + r.Intn(1<<16))
+			}
+		case 2:
+			start := base + r.Intn(1<<15)
+			rb.AddRange(uint32(start), uint32(start+1+r.Intn(1<<15)))
+		}
+	}
+	if r.Intn(2) == 0 {
+		rb.RunOptimize()
+	}
+	return rb
+}
+
+func toImmutable(t *testing.T, rb *RoaringBitmap) (*ImmutableRoaringBitmap, []byte) {
+	buf := new(bytes.Buffer)
+	if _, err := rb.WriteTo(buf); err != nil {
+		t.Fatalf("Failed writing: %v", err)
+	}
+	data := buf.Bytes()
+	irb, err := NewImmutableRoaringBitmap(data)
+	if err != nil {
+		t.Fatalf("Failed opening: %v", err)
+	}
+	if err = irb.Validate(); err != nil {
+		t.Fatalf("Failed validating: %v", err)
+	}
+	return irb, data
+}
+
+func TestImmutableQueries(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		rb := randomMixedBitmap(r, r.Intn(8))
+		irb, _ := toImmutable(t, rb)
+		if irb.GetCardinality() != rb.GetCardinality() || irb.IsEmpty() != rb.IsEmpty() {
+			t.Fatalf("Bad cardinality")
+		}
+		if !irb.ToRoaringBitmap().Equals(rb) {
+			t.Fatalf("Bad copy")
+		}
+		it1, it2 := irb.Iterator(), rb.Iterator()
+		for it2.HasNext() {
+			if !it1.HasNext() || it1.Next() != it2.Next() {
+				t.Fatalf("Bad iterator")
+			}
+		}
+		if it1.HasNext() {
+			t.Fatalf("Iterator is too long")
+		}
+		for j := 0; j < 1000; j++ {
+			x := uint32(r.Intn(64 << 16))
+			if irb.Contains(x) != rb.Contains(x) {
+				t.Fatalf("Bad Contains(%d)", x)
+			}
+			if irb.Rank(x) != rb.Rank(x) {
+				t.Fatalf("Bad Rank(%d)", x)
+			}
+		}
+		card := uint32(rb.GetCardinality())
+		for j := uint32(0); j < card; j += 1 + card/100 {
+			v1, err1 := irb.Select(j)
+			v2, err2 := rb.Select(j)
+			if v1 != v2 || err1 != nil || err2 != nil {
+				t.Fatalf("Bad Select(%d)", j)
+			}
+		}
+		if _, err := irb.Select(card); err == nil {
+			t.Fatalf("Select past the end should fail")
+		}
+	}
+}
+
+func TestImmutableOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		rb1 := randomMixedBitmap(r, r.Intn(8))
+		rb2 := randomMixedBitmap(r, r.Intn(8))
+		irb1, data1 := toImmutable(t, rb1)
+		irb2, data2 := toImmutable(t, rb2)
+		copy1 := append([]byte(nil), data1...)
+		copy2 := append([]byte(nil), data2...)
+		results := []struct {
+			name     string
+			got      *RoaringBitmap
+			expected *RoaringBitmap
+		}{
+			{"And", irb1.And(irb2), And(rb1, rb2)},
+			{"Or", irb1.Or(irb2), Or(rb1, rb2)},
+			{"Xor", irb1.Xor(irb2), Xor(rb1, rb2)},
+			{"AndNot", irb1.AndNot(irb2), AndNot(rb1, rb2)},
+		}
+		for _, res := range results {
+			if !res.got.Equals(res.expected) {
+				t.Fatalf("Bad %s", res.name)
+			}
+			res.got.Flip(0, 64<<16)
+			res.got.AddRange(0, 1<<20)
+		}
+		if !bytes.Equal(data1, copy1) || !bytes.Equal(data2, copy2) {
+			t.Fatalf("Modifying a result changed the serialized bitmaps")
+		}
+	}
+}
+
+func TestImmutableSmallRunBitmap(t *testing.T) {
+	// with run containers and fewer than no_offset_threshold containers,
+	// the offsets are not serialized
+	rb := BitmapOf(1, 2, 3)
+	rb.AddRange(200000, 300000)
+	rb.RunOptimize()
+	irb, data := toImmutable(t, rb)
+	if !irb.ToRoaringBitmap().Equals(rb) {
+		t.Errorf("Bad small bitmap with runs")
+	}
+	_, err := NewImmutableRoaringBitmap(data[:len(data)-1])
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("Truncated small bitmap gave %v", err)
+	}
+}
+
+func TestImmutableAdjacentRuns(t *testing.T) {
+	data := []byte{
+		0x3B, 0x30, 0x00, 0x00, 0x01, 0x00, 0x00, 0x13, 0x00,
+		0x02, 0x00, 0x00, 0x00, 0x09, 0x00, 0x0A, 0x00, 0x09, 0x00, // [0,9] and [10,19]
+	}
+	irb, err := NewImmutableRoaringBitmap(data)
+	if err != nil {
+		t.Fatalf("Failed opening: %v", err)
+	}
+	if err = irb.Validate(); err != nil {
+		t.Fatalf("Failed validating: %v", err)
+	}
+	rb := irb.ToRoaringBitmap()
+	if !rb.ContainsRange(0, 20) || rb.GetCardinality() != 20 || !irb.Contains(15) {
+		t.Errorf("Adjacent runs in a view were not merged")
+	}
+	expected := NewRoaringBitmap()
+	if _, err = expected.ReadFrom(bytes.NewReader(data)); err != nil || !rb.Equals(expected) {
+		t.Errorf("View differs from ReadFrom: %v", err)
+	}
+	if data[13] != 0x09 {
+		t.Errorf("Merging runs modified the buffer")
+	}
+}
+
+func TestImmutableErrors(t *testing.T) {
+	for _, runs := range []bool{false, true} {
+		data := serializedTestBitmap(t, runs)
+		irb, err := NewImmutableRoaringBitmap(data)
+		if err != nil || irb.Validate() != nil {
+			t.Fatalf("Failed opening: %v", err)
+		}
+		if _, err = NewImmutableRoaringBitmap(data[:7]); !errors.Is(err, ErrTruncated) {
+			t.Errorf("Truncated header gave %v", err)
+		}
+		irb, err = NewImmutableRoaringBitmap(data[:len(data)-1])
+		if err != nil {
+			t.Fatalf("Opening should only read the header: %v", err)
+		}
+		if err = irb.Validate(); !errors.Is(err, ErrTruncated) {
+			t.Errorf("Truncated container gave %v", err)
+		}
+	}
+	if _, err := NewImmutableRoaringBitmap([]byte{0, 0, 0, 0}); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("Bad cookie gave %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package roaring
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// JSONFormat selects how a bitmap is represented in JSON
+type JSONFormat int
+
+const (
+	// JSONBase64 is a string holding the portable format in base64, as
+	// returned by ToBase64
+	JSONBase64 JSONFormat = iota
+	// JSONArray is the sorted array of the integers of the bitmap
+	JSONArray
+	// JSONRanges is the sorted array of the maximal [start,last] ranges of
+	// the bitmap, both bounds being included
+	JSONRanges
+)
+
+// MarshalJSON implements the json.Marshaler interface, using the
+// JSONBase64 format
+func (rb *RoaringBitmap) MarshalJSON() ([]byte, error) {
+	return rb.MarshalJSONFormat(JSONBase64)
+}
+
+// MarshalJSONFormat returns the JSON representation of the bitmap in the
+// given format
+func (rb *RoaringBitmap) MarshalJSONFormat(format JSONFormat) ([]byte, error) {
+	switch format {
+	case JSONBase64:
+		str, err := rb.ToBase64()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(str)
+	case JSONArray:
+		buf := []byte{'['}
+		for i := rb.Iterator(); i.HasNext(); {
+			if len(buf) > 1 {
+				buf = append(buf, ',')
+			}
+			buf = strconv.AppendUint(buf, uint64(i.Next()), 10)
+		}
+		return append(buf, ']'), nil
+	case JSONRanges:
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		rb.iterateRanges(func(start, last uint32) bool {
+			if buf.Len() > 1 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, "[%d,%d]", start, last)
+			return true
+		})
+		buf.WriteByte(']')
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("roaring: unknown JSON format %d", format)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, replacing the
+// content of the bitmap. It accepts any of the JSONFormat representations.
+func (rb *RoaringBitmap) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if data[0] == '"' {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		_, err := rb.FromBase64(str)
+		return err
+	}
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+	answer := NewRoaringBitmap()
+	for _, e := range elements {
+		if len(e) > 0 && e[0] == '[' {
+			var r []uint32
+			if err := json.Unmarshal(e, &r); err != nil {
+				return err
+			}
+			if len(r) != 2 || r[0] > r[1] {
+				return fmt.Errorf("roaring: invalid JSON range %s", e)
+			}
+			answer.AddRange(r[0], r[1])
+			answer.Add(r[1])
+		} else {
+			var x uint32
+			if err := json.Unmarshal(e, &x); err != nil {
+				return err
+			}
+			answer.Add(x)
+		}
+	}
+	*rb = *answer
+	return nil
+}
+
+// JSONIntArray wraps a bitmap so that it is marshaled as a JSONArray
+type JSONIntArray struct {
+	*RoaringBitmap
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (b JSONIntArray) MarshalJSON() ([]byte, error) {
+	if b.RoaringBitmap == nil {
+		return []byte("null"), nil
+	}
+	return b.MarshalJSONFormat(JSONArray)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (b *JSONIntArray) UnmarshalJSON(data []byte) error {
+	if b.RoaringBitmap == nil {
+		b.RoaringBitmap = NewRoaringBitmap()
+	}
+	return b.RoaringBitmap.UnmarshalJSON(data)
+}
+
+// JSONIntRanges wraps a bitmap so that it is marshaled as JSONRanges
+type JSONIntRanges struct {
+	*RoaringBitmap
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (b JSONIntRanges) MarshalJSON() ([]byte, error) {
+	if b.RoaringBitmap == nil {
+		return []byte("null"), nil
+	}
+	return b.MarshalJSONFormat(JSONRanges)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (b *JSONIntRanges) UnmarshalJSON(data []byte) error {
+	if b.RoaringBitmap == nil {
+		b.RoaringBitmap = NewRoaringBitmap()
+	}
+	return b.RoaringBitmap.UnmarshalJSON(data)
+}
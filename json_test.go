@@ -0,0 +1,82 @@
+package roaring
+
+// to run just these tests: go test -run TestJSON*
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONFormats(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 5, 70000)
+	rb.AddRange(100, 200)
+	rb.AddRange(65530, 65540) // crossing two containers
+	rb.RunOptimize()
+	expected := map[JSONFormat]string{
+		JSONArray:  "[1,2,3,5,",
+		JSONRanges: `[[1,3],[5,5],[100,199],[65530,65539],[70000,70000]]`,
+	}
+	for format, prefix := range expected {
+		data, err := rb.MarshalJSONFormat(format)
+		if err != nil {
+			t.Fatalf("Failed marshaling: %v", err)
+		}
+		if len(data) < len(prefix) || string(data[:len(prefix)]) != prefix {
+			t.Errorf("Bad JSON %s", data)
+		}
+		newrb := NewRoaringBitmap()
+		if err = json.Unmarshal(data, newrb); err != nil {
+			t.Fatalf("Failed unmarshaling %s: %v", data, err)
+		}
+		if !rb.Equals(newrb) {
+			t.Errorf("Cannot retrieve %s", data)
+		}
+	}
+	str, _ := rb.ToBase64()
+	data, err := json.Marshal(rb)
+	if err != nil || string(data) != `"`+str+`"` {
+		t.Errorf("Bad default JSON %s", data)
+	}
+	for _, format := range []JSONFormat{JSONBase64, JSONArray, JSONRanges} {
+		data, err := NewRoaringBitmap().MarshalJSONFormat(format)
+		if err != nil {
+			t.Fatalf("Failed marshaling: %v", err)
+		}
+		newrb := BitmapOf(1)
+		if err = json.Unmarshal(data, newrb); err != nil || !newrb.IsEmpty() {
+			t.Errorf("Cannot retrieve empty bitmap from %s", data)
+		}
+	}
+}
+
+func TestJSONWrappers(t *testing.T) {
+	type document struct {
+		Default *RoaringBitmap
+		Array   JSONIntArray
+		Ranges  JSONIntRanges
+	}
+	rb := BitmapOf(1, 2, 3, 10)
+	data, err := json.Marshal(document{rb, JSONIntArray{rb}, JSONIntRanges{rb}})
+	if err != nil {
+		t.Fatalf("Failed marshaling: %v", err)
+	}
+	str, _ := rb.ToBase64()
+	if string(data) != `{"Default":"`+str+`","Array":[1,2,3,10],"Ranges":[[1,3],[10,10]]}` {
+		t.Errorf("Bad JSON %s", data)
+	}
+	var doc document
+	if err = json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed unmarshaling: %v", err)
+	}
+	if !rb.Equals(doc.Default) || !rb.Equals(doc.Array.RoaringBitmap) || !rb.Equals(doc.Ranges.RoaringBitmap) {
+		t.Errorf("Cannot retrieve marshaled document")
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	for _, data := range []string{`[[3,1]]`, `[[1,2,3]]`, `[-1]`, `[1.5]`, `{}`, `"!"`, `[4294967296]`} {
+		if err := json.Unmarshal([]byte(data), NewRoaringBitmap()); err == nil {
+			t.Errorf("Unmarshaling %s should fail", data)
+		}
+	}
+}
@@ -37,6 +37,43 @@ func (b *RoaringBitmap) FromBase64(str string) (int, error) {
 
 }
 
+// MarshalBinary implements the encoding.BinaryMarshaler interface, using
+// the same portable format as WriteTo
+func (rb *RoaringBitmap) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	_, err := rb.WriteTo(buf)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface,
+// replacing the content of the bitmap with a copy of data
+func (rb *RoaringBitmap) UnmarshalBinary(data []byte) error {
+	_, err := rb.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// GobEncode implements the gob.GobEncoder interface
+func (rb *RoaringBitmap) GobEncode() ([]byte, error) {
+	return rb.MarshalBinary()
+}
+
+// GobDecode implements the gob.GobDecoder interface
+func (rb *RoaringBitmap) GobDecode(data []byte) error {
+	return rb.UnmarshalBinary(data)
+}
+
+// RunOptimize converts each container to whichever of the array, bitmap or
+// run representations is the most compact, typically after bulk loading
+// with AddRange
+func (rb *RoaringBitmap) RunOptimize() {
+	rb.highlowcontainer.runOptimize()
+}
+
+// HasRunCompression returns true if the bitmap holds at least one run container
+func (rb *RoaringBitmap) HasRunCompression() bool {
+	return rb.highlowcontainer.hasRunCompression()
+}
+
 // Write out a serialized version of this bitmap to stream
 func (b *RoaringBitmap) WriteTo(stream io.Writer) (int, error) {
 	return b.highlowcontainer.writeTo(stream)
@@ -47,6 +84,15 @@ func (b *RoaringBitmap) ReadFrom(stream io.Reader) (int, error) {
 	return b.highlowcontainer.readFrom(stream)
 }
 
+// FromBuffer loads a serialized version of this bitmap from buf without
+// copying the container data on little-endian platforms. The bitmap keeps
+// referring to buf until a container is modified, at which point that
+// container is copied: buf itself is never written to, but it must not be
+// changed while the bitmap is in use.
+func (b *RoaringBitmap) FromBuffer(buf []byte) (int, error) {
+	return b.highlowcontainer.fromBuffer(buf)
+}
+
 // NewRoaringBitmap creates a new empty RoaringBitmap
 func NewRoaringBitmap() *RoaringBitmap {
 	return &RoaringBitmap{*newRoaringArray()}
@@ -95,10 +141,20 @@ type IntIterable interface {
 	Next() uint32
 }
 
+// IntPeekable is an IntIterable that can also look at the next integer
+// without consuming it, and skip integers efficiently
+type IntPeekable interface {
+	IntIterable
+	// PeekNext returns the next integer without advancing the iterator
+	PeekNext() uint32
+	// AdvanceIfNeeded skips the integers smaller than minval
+	AdvanceIfNeeded(minval uint32)
+}
+
 type intIterator struct {
 	pos              int
 	hs               uint32
-	iter             shortIterable
+	iter             shortPeekable
 	highlowcontainer *roaringArray
 }
 
@@ -124,6 +180,28 @@ func (ii *intIterator) Next() uint32 {
 	return x
 }
 
+// PeekNext returns the next integer without advancing the iterator
+func (ii *intIterator) PeekNext() uint32 {
+	return toIntUnsigned(ii.iter.peekNext()) | ii.hs
+}
+
+// AdvanceIfNeeded skips the integers smaller than minval, jumping over
+// whole containers
+func (ii *intIterator) AdvanceIfNeeded(minval uint32) {
+	to := highbits(minval)
+	if ii.HasNext() && ii.highlowcontainer.getKeyAtIndex(ii.pos) < to {
+		ii.pos = ii.highlowcontainer.advanceUntil(to, ii.pos)
+		ii.init()
+	}
+	if ii.HasNext() && ii.highlowcontainer.getKeyAtIndex(ii.pos) == to {
+		ii.iter.advanceIfNeeded(lowbits(minval))
+		if !ii.iter.hasNext() {
+			ii.pos = ii.pos + 1
+			ii.init()
+		}
+	}
+}
+
 func newIntIterator(a *RoaringBitmap) *intIterator {
 	p := new(intIterator)
 	p.pos = 0
@@ -132,6 +210,137 @@ func newIntIterator(a *RoaringBitmap) *intIterator {
 	return p
 }
 
+// RangeIterable allows you to iterate over the maximal ranges [start,last]
+// of consecutive integers in a RoaringBitmap, both bounds being included
+type RangeIterable interface {
+	HasNext() bool
+	Next() (start, last uint32)
+}
+
+type rangeIterator struct {
+	pos              int
+	from             int
+	hasNext          bool
+	start, last      uint32
+	highlowcontainer *roaringArray
+}
+
+// HasNext returns true if there are more ranges to iterate over
+func (ri *rangeIterator) HasNext() bool {
+	return ri.hasNext
+}
+
+// Next returns the next range [start,last]
+func (ri *rangeIterator) Next() (uint32, uint32) {
+	start, last := ri.start, ri.last
+	ri.advance()
+	return start, last
+}
+
+// advance finds the next range, merging runs across containers
+func (ri *rangeIterator) advance() {
+	ri.hasNext = false
+	for ri.pos < ri.highlowcontainer.size() {
+		hs := toIntUnsigned(ri.highlowcontainer.getKeyAtIndex(ri.pos)) << 16
+		start, last := ri.highlowcontainer.getContainerAtIndex(ri.pos).nextRun(ri.from)
+		if start < 0 {
+			ri.pos++
+			ri.from = 0
+			continue
+		}
+		if ri.hasNext && hs|uint32(start) != ri.last+1 {
+			return
+		}
+		if !ri.hasNext {
+			ri.start = hs | uint32(start)
+			ri.hasNext = true
+		}
+		ri.last = hs | uint32(last)
+		ri.from = last + 1
+		if last < maxCapacity-1 {
+			// the run cannot continue in the next container
+			return
+		}
+	}
+}
+
+func newRangeIterator(a *RoaringBitmap) *rangeIterator {
+	ri := &rangeIterator{highlowcontainer: &a.highlowcontainer}
+	ri.advance()
+	return ri
+}
+
+// ManyIntIterable allows you to iterate over the values in a RoaringBitmap in batches
+type ManyIntIterable interface {
+	// NextMany fills buf with the next integers and returns how many were
+	// written; it returns 0 once the iteration is over
+	NextMany(buf []uint32) int
+}
+
+type manyIntIterator struct {
+	pos              int
+	cursor           int
+	highlowcontainer *roaringArray
+}
+
+// NextMany fills buf with the next integers, decoding whole containers at
+// once, and returns how many were written
+func (ii *manyIntIterator) NextMany(buf []uint32) int {
+	n := 0
+	for n < len(buf) && ii.pos < ii.highlowcontainer.size() {
+		hs := toIntUnsigned(ii.highlowcontainer.getKeyAtIndex(ii.pos)) << 16
+		moreN, cursor := ii.highlowcontainer.getContainerAtIndex(ii.pos).nextMany(hs, buf[n:], ii.cursor)
+		n += moreN
+		ii.cursor = cursor
+		if moreN == 0 {
+			ii.pos++
+			ii.cursor = 0
+		}
+	}
+	return n
+}
+
+func newManyIntIterator(a *RoaringBitmap) *manyIntIterator {
+	return &manyIntIterator{highlowcontainer: &a.highlowcontainer}
+}
+
+type intReverseIterator struct {
+	pos              int
+	hs               uint32
+	iter             shortIterable
+	highlowcontainer *roaringArray
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (ii *intReverseIterator) HasNext() bool {
+	return ii.pos >= 0
+}
+
+func (ii *intReverseIterator) init() {
+	if ii.pos >= 0 {
+		ii.iter = ii.highlowcontainer.getContainerAtIndex(ii.pos).getReverseIterator()
+		ii.hs = toIntUnsigned(ii.highlowcontainer.getKeyAtIndex(ii.pos)) << 16
+	}
+}
+
+// Next returns the next integer
+func (ii *intReverseIterator) Next() uint32 {
+	x := toIntUnsigned(ii.iter.next()) | ii.hs
+	if !ii.iter.hasNext() {
+		ii.pos = ii.pos - 1
+		ii.init()
+	}
+	return x
+}
+
+func newIntReverseIterator(a *RoaringBitmap) *intReverseIterator {
+	p := new(intReverseIterator)
+	p.highlowcontainer = &a.highlowcontainer
+	p.pos = a.highlowcontainer.size() - 1
+	p.init()
+	return p
+}
+
 // String creates a string representation of the RoaringBitmap
 func (rb *RoaringBitmap) String() string {
 	// inspired by https://github.com/fzandona/goroar/blob/master/roaringbitmap.go
@@ -149,11 +358,59 @@ func (rb *RoaringBitmap) String() string {
 	return buffer.String()
 }
 
-// Iterator creates a new IntIterable to iterate over the integers contained in the bitmap, in sorted order
-func (rb *RoaringBitmap) Iterator() IntIterable {
+// Iterator creates a new IntPeekable to iterate over the integers contained in the bitmap, in sorted order
+func (rb *RoaringBitmap) Iterator() IntPeekable {
 	return newIntIterator(rb)
 }
 
+// Iterate calls f on the integers contained in the bitmap, in sorted order,
+// until f returns false
+func (rb *RoaringBitmap) Iterate(f func(x uint32) bool) {
+	for i := 0; i < rb.highlowcontainer.size(); i++ {
+		hs := toIntUnsigned(rb.highlowcontainer.getKeyAtIndex(i)) << 16
+		if !rb.highlowcontainer.getContainerAtIndex(i).iterate(hs, f) {
+			return
+		}
+	}
+}
+
+// iterateRanges calls f on the maximal ranges [start,last] of consecutive
+// integers contained in the bitmap, in sorted order, until f returns false
+func (rb *RoaringBitmap) iterateRanges(f func(start, last uint32) bool) {
+	for ri := newRangeIterator(rb); ri.HasNext(); {
+		if !f(ri.Next()) {
+			return
+		}
+	}
+}
+
+// RangeIterator creates a new RangeIterable to iterate over the maximal
+// ranges [start,last] of consecutive integers contained in the bitmap
+func (rb *RoaringBitmap) RangeIterator() RangeIterable {
+	return newRangeIterator(rb)
+}
+
+// ToRanges returns the maximal ranges [start,last] of consecutive integers
+// contained in the bitmap, in sorted order, both bounds being included
+func (rb *RoaringBitmap) ToRanges() [][2]uint32 {
+	var ranges [][2]uint32
+	rb.iterateRanges(func(start, last uint32) bool {
+		ranges = append(ranges, [2]uint32{start, last})
+		return true
+	})
+	return ranges
+}
+
+// ManyIterator creates a new ManyIntIterable to iterate over the integers contained in the bitmap, in sorted order
+func (rb *RoaringBitmap) ManyIterator() ManyIntIterable {
+	return newManyIntIterator(rb)
+}
+
+// ReverseIterator creates a new IntIterable to iterate over the integers contained in the bitmap, in decreasing order
+func (rb *RoaringBitmap) ReverseIterator() IntIterable {
+	return newIntReverseIterator(rb)
+}
+
 // Clone creates a copy of the RoaringBitmap
 func (rb *RoaringBitmap) Clone() *RoaringBitmap {
 	ptr := new(RoaringBitmap)
@@ -202,13 +459,124 @@ func (rb *RoaringBitmap) Add(x uint32) {
 	}
 }
 
+// sortThreshold is the length under which unsorted slices given to AddMany
+// and RemoveMany are processed one integer at a time rather than sorted
+const sortThreshold = 32
+
+// AddMany adds all the integers in dat to the bitmap. The integers are
+// grouped by their high bits, sorting a copy of dat when it is not already
+// sorted, and each group is built and merged into its container in one pass.
+// dat is not modified.
+func (rb *RoaringBitmap) AddMany(dat []uint32) {
+	if len(dat) < sortThreshold && !isSorted(dat) {
+		for _, x := range dat {
+			rb.Add(x)
+		}
+		return
+	}
+	ra := &rb.highlowcontainer
+	dat = sortedCopy(dat)
+	for i := 0; i < len(dat); {
+		j := sortedGroupEnd(dat, i)
+		if j == i+1 {
+			rb.Add(dat[i])
+			i = j
+			continue
+		}
+		hb := highbits(dat[i])
+		c := newContainerFromSorted(dat[i:j])
+		if idx := ra.getIndex(hb); idx >= 0 {
+			ra.setContainerAtIndex(idx, ra.getWritableContainerAtIndex(idx).ior(c))
+		} else {
+			ra.insertNewKeyValueAt(-idx-1, hb, c)
+		}
+		i = j
+	}
+}
+
+// RemoveMany removes all the integers in dat from the bitmap, grouping them
+// like AddMany
+func (rb *RoaringBitmap) RemoveMany(dat []uint32) {
+	if len(dat) < sortThreshold && !isSorted(dat) {
+		for _, x := range dat {
+			rb.Remove(x)
+		}
+		return
+	}
+	ra := &rb.highlowcontainer
+	dat = sortedCopy(dat)
+	for i := 0; i < len(dat); {
+		j := sortedGroupEnd(dat, i)
+		if j == i+1 {
+			rb.Remove(dat[i])
+			i = j
+			continue
+		}
+		if idx := ra.getIndex(highbits(dat[i])); idx >= 0 {
+			c := ra.getWritableContainerAtIndex(idx).iandNot(newContainerFromSorted(dat[i:j]))
+			if c.getCardinality() > 0 {
+				ra.setContainerAtIndex(idx, c)
+			} else {
+				ra.removeAtIndex(idx)
+			}
+		}
+		i = j
+	}
+}
+
+// sortedCopy returns dat when it is sorted, and a sorted copy of it otherwise
+func sortedCopy(dat []uint32) []uint32 {
+	if isSorted(dat) {
+		return dat
+	}
+	buf := make([]uint32, 2*len(dat))
+	sorted := buf[:len(dat):len(dat)]
+	copy(sorted, dat)
+	return radixSort(sorted, buf[len(dat):])
+}
+
+// sortedGroupEnd returns the end of the run of sorted integers sharing their
+// high bits that starts at dat[i]
+func sortedGroupEnd(dat []uint32, i int) int {
+	hb := highbits(dat[i])
+	j := i + 1
+	for j < len(dat) && dat[j] >= dat[j-1] && highbits(dat[j]) == hb {
+		j++
+	}
+	return j
+}
+
+// newContainerFromSorted builds the container of the sorted integers in dat,
+// which share their high bits and may be repeated. The type of container is
+// chosen from len(dat) up front.
+func newContainerFromSorted(dat []uint32) container {
+	if len(dat) > arrayDefaultMaxSize {
+		bc := newBitmapContainer()
+		for _, x := range dat {
+			bc.add(lowbits(x))
+		}
+		if bc.cardinality <= arrayDefaultMaxSize {
+			return bc.toArrayContainer()
+		}
+		return bc
+	}
+	ac := newArrayContainerCapacity(len(dat))
+	for _, x := range dat {
+		low := lowbits(x)
+		if len(ac.content) == 0 || ac.content[len(ac.content)-1] != low {
+			ac.content = append(ac.content, low)
+		}
+	}
+	return ac
+}
+
 // Add the integer x to the bitmap and return true  if it was added (false if the integer was already present)
 func (rb *RoaringBitmap) CheckedAdd(x uint32) bool {
 	// TODO: add unit tests for this method
 	hb := highbits(x)
 	i := rb.highlowcontainer.getIndex(hb)
 	if i >= 0 {
-		C := rb.highlowcontainer.getContainerAtIndex(i)
+		C := rb.highlowcontainer.getWritableContainerAtIndex(i)
 		oldcard := C.getCardinality()
 		C = C.add(lowbits(x))
 		rb.highlowcontainer.setContainerAtIndex(i, C)
@@ -244,7 +612,7 @@ func (rb *RoaringBitmap) CheckedRemove(x uint32) bool {
 	hb := highbits(x)
 	i := rb.highlowcontainer.getIndex(hb)
 	if i >= 0 {
-		C := rb.highlowcontainer.getContainerAtIndex(i)
+		C := rb.highlowcontainer.getWritableContainerAtIndex(i)
 		oldcard := C.getCardinality()
 		C = C.remove(lowbits(x))
 		rb.highlowcontainer.setContainerAtIndex(i, C)
@@ -272,6 +640,255 @@ func (rb *RoaringBitmap) GetCardinality() uint64 {
 	return size
 }
 
+// Minimum returns the smallest integer in the bitmap
+func (rb *RoaringBitmap) Minimum() (uint32, error) {
+	if rb.IsEmpty() {
+		return 0, fmt.Errorf("Can't find the minimum of an empty bitmap")
+	}
+	key := rb.highlowcontainer.getKeyAtIndex(0)
+	return uint32(key)<<16 | uint32(rb.highlowcontainer.getContainerAtIndex(0).minimum()), nil
+}
+
+// Maximum returns the largest integer in the bitmap
+func (rb *RoaringBitmap) Maximum() (uint32, error) {
+	if rb.IsEmpty() {
+		return 0, fmt.Errorf("Can't find the maximum of an empty bitmap")
+	}
+	i := rb.highlowcontainer.size() - 1
+	key := rb.highlowcontainer.getKeyAtIndex(i)
+	return uint32(key)<<16 | uint32(rb.highlowcontainer.getContainerAtIndex(i).maximum()), nil
+}
+
+// NextValue returns the smallest integer in the bitmap that is larger or
+// equal to x, or -1 if there is none
+func (rb *RoaringBitmap) NextValue(x uint32) int64 {
+	hb := highbits(x)
+	i := rb.highlowcontainer.getIndex(hb)
+	if i >= 0 {
+		if v := rb.highlowcontainer.getContainerAtIndex(i).nextValue(lowbits(x)); v >= 0 {
+			return int64(hb)<<16 | int64(v)
+		}
+		i++
+	} else {
+		i = -i - 1
+	}
+	if i == rb.highlowcontainer.size() {
+		return -1
+	}
+	key := rb.highlowcontainer.getKeyAtIndex(i)
+	return int64(key)<<16 | int64(rb.highlowcontainer.getContainerAtIndex(i).minimum())
+}
+
+// PreviousValue returns the largest integer in the bitmap that is smaller
+// or equal to x, or -1 if there is none
+func (rb *RoaringBitmap) PreviousValue(x uint32) int64 {
+	hb := highbits(x)
+	i := rb.highlowcontainer.getIndex(hb)
+	if i >= 0 {
+		if v := rb.highlowcontainer.getContainerAtIndex(i).previousValue(lowbits(x)); v >= 0 {
+			return int64(hb)<<16 | int64(v)
+		}
+		i--
+	} else {
+		i = -i - 2
+	}
+	if i < 0 {
+		return -1
+	}
+	key := rb.highlowcontainer.getKeyAtIndex(i)
+	return int64(key)<<16 | int64(rb.highlowcontainer.getContainerAtIndex(i).maximum())
+}
+
+// NextAbsentValue returns the smallest integer missing from the bitmap that
+// is larger or equal to x, or -1 if there is none
+func (rb *RoaringBitmap) NextAbsentValue(x uint32) int64 {
+	for v := int64(x); v < 1<<32; {
+		hb := uint16(v >> 16)
+		i := rb.highlowcontainer.getIndex(hb)
+		if i < 0 {
+			return v
+		}
+		low := rb.highlowcontainer.getContainerAtIndex(i).nextAbsentValue(uint16(v))
+		if low < maxCapacity {
+			return int64(hb)<<16 | int64(low)
+		}
+		// the container is full up to its end, go on with the next one
+		v = (int64(hb) + 1) << 16
+	}
+	return -1
+}
+
+// PreviousAbsentValue returns the largest integer missing from the bitmap
+// that is smaller or equal to x, or -1 if there is none
+func (rb *RoaringBitmap) PreviousAbsentValue(x uint32) int64 {
+	for v := int64(x); v >= 0; {
+		hb := uint16(v >> 16)
+		i := rb.highlowcontainer.getIndex(hb)
+		if i < 0 {
+			return v
+		}
+		low := rb.highlowcontainer.getContainerAtIndex(i).previousAbsentValue(uint16(v))
+		if low >= 0 {
+			return int64(hb)<<16 | int64(low)
+		}
+		// the container is full down to its start, go on with the previous one
+		v = int64(hb)<<16 - 1
+	}
+	return -1
+}
+
+// CardinalityInRange returns the number of integers of the bitmap in
+// [rangeStart,rangeEnd), rangeEnd being at most 1<<32
+func (rb *RoaringBitmap) CardinalityInRange(rangeStart, rangeEnd uint64) uint64 {
+	if rangeEnd > 1<<32 {
+		rangeEnd = 1 << 32
+	}
+	if rangeStart >= rangeEnd {
+		return 0
+	}
+	hbStart := uint16(rangeStart >> 16)
+	hbLast := uint16((rangeEnd - 1) >> 16)
+	i := rb.highlowcontainer.getIndex(hbStart)
+	if i < 0 {
+		i = -i - 1
+	}
+	answer := uint64(0)
+	for ; i < rb.highlowcontainer.size(); i++ {
+		key := rb.highlowcontainer.getKeyAtIndex(i)
+		if key > hbLast {
+			break
+		}
+		start, end := containerRange(key, rangeStart, rangeEnd)
+		answer += uint64(rb.highlowcontainer.getContainerAtIndex(i).cardinalityInRange(start, end))
+	}
+	return answer
+}
+
+// RangeCardinality is CardinalityInRange
+func (rb *RoaringBitmap) RangeCardinality(rangeStart, rangeEnd uint64) uint64 {
+	return rb.CardinalityInRange(rangeStart, rangeEnd)
+}
+
+// ContainsRange checks whether all the integers in [rangeStart,rangeEnd)
+// belong to the bitmap, rangeEnd being at most 1<<32. An empty range is
+// always contained.
+func (rb *RoaringBitmap) ContainsRange(rangeStart, rangeEnd uint64) bool {
+	if rangeEnd > 1<<32 {
+		return false
+	}
+	if rangeStart >= rangeEnd {
+		return true
+	}
+	hbStart := uint16(rangeStart >> 16)
+	hbLast := uint16((rangeEnd - 1) >> 16)
+	i := rb.highlowcontainer.getIndex(hbStart)
+	if i < 0 || rb.highlowcontainer.size()-i <= int(hbLast-hbStart) {
+		return false
+	}
+	// every key from hbStart to hbLast must be present
+	for key := int(hbStart); key <= int(hbLast); key++ {
+		if rb.highlowcontainer.getKeyAtIndex(i) != uint16(key) {
+			return false
+		}
+		start, end := containerRange(uint16(key), rangeStart, rangeEnd)
+		if !rb.highlowcontainer.getContainerAtIndex(i).containsRange(start, end) {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// IntersectsRange checks whether any integer in [rangeStart,rangeEnd)
+// belongs to the bitmap, rangeEnd being at most 1<<32
+func (rb *RoaringBitmap) IntersectsRange(rangeStart, rangeEnd uint64) bool {
+	if rangeEnd > 1<<32 {
+		rangeEnd = 1 << 32
+	}
+	if rangeStart >= rangeEnd {
+		return false
+	}
+	hbStart := uint16(rangeStart >> 16)
+	hbLast := uint16((rangeEnd - 1) >> 16)
+	i := rb.highlowcontainer.getIndex(hbStart)
+	if i < 0 {
+		i = -i - 1
+	}
+	for ; i < rb.highlowcontainer.size(); i++ {
+		key := rb.highlowcontainer.getKeyAtIndex(i)
+		if key > hbLast {
+			break
+		}
+		start, end := containerRange(key, rangeStart, rangeEnd)
+		if rb.highlowcontainer.getContainerAtIndex(i).intersectsRange(start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// Slice returns a new bitmap with the integers of the bitmap in
+// [rangeStart,rangeEnd). The containers that fall entirely within the range
+// are shared with the new bitmap, and copied on write.
+func (rb *RoaringBitmap) Slice(rangeStart, rangeEnd uint32) *RoaringBitmap {
+	answer := NewRoaringBitmap()
+	if rangeStart >= rangeEnd {
+		return answer
+	}
+	hbLast := highbits(rangeEnd - 1)
+	i := rb.highlowcontainer.getIndex(highbits(rangeStart))
+	if i < 0 {
+		i = -i - 1
+	}
+	for ; i < rb.highlowcontainer.size(); i++ {
+		key := rb.highlowcontainer.getKeyAtIndex(i)
+		if key > hbLast {
+			break
+		}
+		start, end := containerRange(key, uint64(rangeStart), uint64(rangeEnd))
+		c := rb.highlowcontainer.getContainerAtIndex(i)
+		if int(c.minimum()) >= start && int(c.maximum()) < end {
+			answer.highlowcontainer.appendShared(&rb.highlowcontainer, i)
+			continue
+		}
+		c = c.clone()
+		if start > 0 {
+			c = c.iremoveRange(0, start)
+		}
+		if end < maxCapacity {
+			c = c.iremoveRange(end, maxCapacity)
+		}
+		if c.getCardinality() > 0 {
+			answer.highlowcontainer.appendContainer(key, c)
+		}
+	}
+	return answer
+}
+
+// Retain removes from the bitmap the integers that are not in
+// [rangeStart,rangeEnd)
+func (rb *RoaringBitmap) Retain(rangeStart, rangeEnd uint32) {
+	if rangeStart >= rangeEnd {
+		rb.Clear()
+		return
+	}
+	rb.removeRange(0, uint64(rangeStart))
+	rb.removeRange(uint64(rangeEnd), 1<<32)
+}
+
+// containerRange returns the part of the non-empty range [rangeStart,rangeEnd)
+// that falls in the container with the given key
+func containerRange(key uint16, rangeStart, rangeEnd uint64) (int, int) {
+	start, end := 0, maxCapacity
+	if key == uint16(rangeStart>>16) {
+		start = int(rangeStart & 0xFFFF)
+	}
+	if key == uint16((rangeEnd-1)>>16) {
+		end = int((rangeEnd-1)&0xFFFF) + 1
+	}
+	return start, end
+}
+
 // Rank returns the number of integers that are smaller or equal to x (Rank(infinity) would be GetCardinality())
 func (rb *RoaringBitmap) Rank(x uint32) uint32 {
 	size := uint32(0)
@@ -387,8 +1004,9 @@ main:
 					}
 					s2 = x2.highlowcontainer.getKeyAtIndex(pos2)
 				} else {
-					// TODO: could be faster if we did not have to materialize the container
-					answer += uint64(x1.highlowcontainer.getContainerAtIndex(pos1).or(x2.highlowcontainer.getContainerAtIndex(pos2)).getCardinality())
+					c1 := x1.highlowcontainer.getContainerAtIndex(pos1)
+					c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
+					answer += uint64(c1.getCardinality() + c2.getCardinality() - c1.andCardinality(c2))
 					pos1++
 					pos2++
 					if (pos1 == length1) || (pos2 == length2) {
@@ -426,10 +1044,9 @@ main:
 			s2 := x2.highlowcontainer.getKeyAtIndex(pos2)
 			for {
 				if s1 == s2 {
-					c1 := rb.highlowcontainer.getWritableContainerAtIndex(pos1)
+					c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
 					c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
-					diff := c1.and(c2)
-					answer += uint64(diff.getCardinality()) // TODO: could be faster if we did not have to compute diff
+					answer += uint64(c1.andCardinality(c2))
 					pos1++
 					pos2++
 					if (pos1 == length1) || (pos2 == length2) {
@@ -458,6 +1075,108 @@ main:
 	return answer
 }
 
+// XorCardinality returns the cardinality of the symmetric difference between two bitmaps, bitmaps are not modified
+func (rb *RoaringBitmap) XorCardinality(x2 *RoaringBitmap) uint64 {
+	pos1 := 0
+	pos2 := 0
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+	answer := uint64(0)
+	for pos1 < length1 && pos2 < length2 {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		s2 := x2.highlowcontainer.getKeyAtIndex(pos2)
+		if s1 < s2 {
+			answer += uint64(rb.highlowcontainer.getContainerAtIndex(pos1).getCardinality())
+			pos1++
+		} else if s1 > s2 {
+			answer += uint64(x2.highlowcontainer.getContainerAtIndex(pos2).getCardinality())
+			pos2++
+		} else {
+			c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+			answer += uint64(c1.xorCardinality(x2.highlowcontainer.getContainerAtIndex(pos2)))
+			pos1++
+			pos2++
+		}
+	}
+	for ; pos1 < length1; pos1++ {
+		answer += uint64(rb.highlowcontainer.getContainerAtIndex(pos1).getCardinality())
+	}
+	for ; pos2 < length2; pos2++ {
+		answer += uint64(x2.highlowcontainer.getContainerAtIndex(pos2).getCardinality())
+	}
+	return answer
+}
+
+// AndNotCardinality returns the cardinality of the difference between two bitmaps, bitmaps are not modified
+func (rb *RoaringBitmap) AndNotCardinality(x2 *RoaringBitmap) uint64 {
+	pos2 := 0
+	length2 := x2.highlowcontainer.size()
+	answer := uint64(0)
+	for pos1 := 0; pos1 < rb.highlowcontainer.size(); pos1++ {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+		if pos2 < length2 && x2.highlowcontainer.getKeyAtIndex(pos2) < s1 {
+			pos2 = x2.highlowcontainer.advanceUntil(s1, pos2)
+		}
+		if pos2 < length2 && x2.highlowcontainer.getKeyAtIndex(pos2) == s1 {
+			answer += uint64(c1.andNotCardinality(x2.highlowcontainer.getContainerAtIndex(pos2)))
+		} else {
+			answer += uint64(c1.getCardinality())
+		}
+	}
+	return answer
+}
+
+// Jaccard returns the Jaccard similarity of two bitmaps, the cardinality of
+// their intersection divided by the cardinality of their union. Two empty
+// bitmaps have a similarity of 1.
+func Jaccard(x1, x2 *RoaringBitmap) float64 {
+	and := x1.AndCardinality(x2)
+	or := x1.GetCardinality() + x2.GetCardinality() - and
+	if or == 0 {
+		return 1
+	}
+	return float64(and) / float64(or)
+}
+
+// Dice returns the Sørensen-Dice similarity of two bitmaps, twice the
+// cardinality of their intersection divided by the sum of their
+// cardinalities. Two empty bitmaps have a similarity of 1.
+func Dice(x1, x2 *RoaringBitmap) float64 {
+	sum := x1.GetCardinality() + x2.GetCardinality()
+	if sum == 0 {
+		return 1
+	}
+	return float64(2*x1.AndCardinality(x2)) / float64(sum)
+}
+
+// IsSubset checks whether all the integers of the bitmap are in x2, bitmaps are not modified
+func (rb *RoaringBitmap) IsSubset(x2 *RoaringBitmap) bool {
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+	if length1 > length2 {
+		return false
+	}
+	pos2 := 0
+	for pos1 := 0; pos1 < length1; pos1++ {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		pos2 = x2.highlowcontainer.advanceUntil(s1, pos2-1)
+		if pos2 == length2 || x2.highlowcontainer.getKeyAtIndex(pos2) != s1 {
+			return false
+		}
+		if !rb.highlowcontainer.getContainerAtIndex(pos1).isSubset(x2.highlowcontainer.getContainerAtIndex(pos2)) {
+			return false
+		}
+		pos2++
+	}
+	return true
+}
+
+// IsSuperset checks whether all the integers of x2 are in the bitmap, bitmaps are not modified
+func (rb *RoaringBitmap) IsSuperset(x2 *RoaringBitmap) bool {
+	return x2.IsSubset(rb)
+}
+
 // Intersects checks whether two bitmap intersects, bitmaps are not modified
 func (rb *RoaringBitmap) Intersects(x2 *RoaringBitmap) bool {
 	pos1 := 0
@@ -521,7 +1240,7 @@ func (rb *RoaringBitmap) Xor(x2 *RoaringBitmap) {
 					break
 				}
 			} else if s1 > s2 {
-				c := x2.highlowcontainer.getWritableContainerAtIndex(pos2)
+				c := x2.highlowcontainer.getContainerAtIndex(pos2).clone()
 				rb.highlowcontainer.insertNewKeyValueAt(pos1, x2.highlowcontainer.getKeyAtIndex(pos2), c)
 				length1++
 				pos1++
@@ -605,7 +1324,7 @@ main:
 	}
 	// TODO:implement as a copy
 	for pos1 < length1 {
-		c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+		c1 := rb.highlowcontainer.getWritableContainerAtIndex(pos1)
 		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
 		rb.highlowcontainer.replaceKeyAndContainerAtIndex(intersectionsize, s1, c1)
 		intersectionsize++
@@ -807,8 +1526,16 @@ main:
 // BitmapOf generates a new bitmap filled with the specified integer
 func BitmapOf(dat ...uint32) *RoaringBitmap {
 	ans := NewRoaringBitmap()
-	for _, i := range dat {
-		ans.Add(i)
+	ans.AddMany(dat)
+	return ans
+}
+
+// FromRanges generates a new bitmap filled with the ranges [start,last], as
+// returned by ToRanges
+func FromRanges(ranges [][2]uint32) *RoaringBitmap {
+	ans := NewRoaringBitmap()
+	for _, r := range ranges {
+		ans.addRange(uint64(r[0]), uint64(r[1])+1)
 	}
 	return ans
 }
@@ -816,41 +1543,35 @@ func BitmapOf(dat ...uint32) *RoaringBitmap {
 // Flip negates the bits in the given range, any integer present in this range and in the bitmap is removed,
 // and any integer present in the range and not in the bitmap is added
 func (rb *RoaringBitmap) Flip(rangeStart, rangeEnd uint32) {
+	rb.flip(uint64(rangeStart), uint64(rangeEnd))
+}
 
+// flip is Flip with bounds wide enough to reach 1<<32
+func (rb *RoaringBitmap) flip(rangeStart, rangeEnd uint64) {
 	if rangeStart >= rangeEnd {
 		return
 	}
 
-	hbStart := highbits(rangeStart)
-	lbStart := lowbits(rangeStart)
-	hbLast := highbits(rangeEnd - 1)
-	lbLast := lowbits(rangeEnd - 1)
+	hbStart := int(rangeStart >> 16)
+	lbStart := uint32(rangeStart & 0xFFFF)
+	hbLast := int((rangeEnd - 1) >> 16)
+	lbLast := uint32((rangeEnd - 1) & 0xFFFF)
 
 	max := toIntUnsigned(maxLowBit())
-	for hb := hbStart; hb <= hbLast; hb++ {
+	rb.highlowcontainer.updateRange(hbStart, hbLast, func(hb uint16, c container) container {
 		containerStart := uint32(0)
-		if hb == hbStart {
-			containerStart = toIntUnsigned(lbStart)
+		if int(hb) == hbStart {
+			containerStart = lbStart
 		}
 		containerLast := max
-		if hb == hbLast {
-			containerLast = toIntUnsigned(lbLast)
+		if int(hb) == hbLast {
+			containerLast = lbLast
 		}
-
-		i := rb.highlowcontainer.getIndex(hb)
-
-		if i >= 0 {
-			c := rb.highlowcontainer.getWritableContainerAtIndex(i).inot(int(containerStart), int(containerLast))
-			if c.getCardinality() > 0 {
-				rb.highlowcontainer.setContainerAtIndex(i, c)
-			} else {
-				rb.highlowcontainer.removeAtIndex(i)
-			}
-		} else { // *think* the range of ones must never be
-			// empty.
-			rb.highlowcontainer.insertNewKeyValueAt(-i-1, hb, rangeOfOnes(int(containerStart), int(containerLast)))
+		if c == nil {
+			return rangeOfOnes(int(containerStart), int(containerLast))
 		}
-	}
+		return c.inot(int(containerStart), int(containerLast))
+	})
 }
 
 // FlipInt calls Flip after casting the parameters to uint32 (convenience method)
@@ -858,50 +1579,83 @@ func (rb *RoaringBitmap) FlipInt(rangeStart, rangeEnd int) {
 	rb.Flip(uint32(rangeStart), uint32(rangeEnd))
 }
 
+// Complement negates all the bits of the bitmap, over [0,1<<32). The
+// missing containers are added full, as single runs.
+func (rb *RoaringBitmap) Complement() {
+	rb.highlowcontainer.updateRange(0, maxCapacity-1, func(hb uint16, c container) container {
+		if c == nil {
+			return newRunContainerRange(0, maxCapacity-1)
+		}
+		return c.inot(0, maxCapacity-1)
+	})
+}
+
+// Flip64 is Flip with a rangeEnd of at most 1<<32, so that the largest
+// uint32 can be included
+func (rb *RoaringBitmap) Flip64(rangeStart, rangeEnd uint64) {
+	if rangeEnd > 1<<32 {
+		rangeEnd = 1 << 32
+	}
+	rb.flip(rangeStart, rangeEnd)
+}
+
 // Add the integers in [rangeStart, rangeEnd) to the bitmap
 func (rb *RoaringBitmap) AddRange(rangeStart, rangeEnd uint32) {
+	rb.addRange(uint64(rangeStart), uint64(rangeEnd))
+}
+
+// addRange is AddRange with bounds wide enough to reach 1<<32
+func (rb *RoaringBitmap) addRange(rangeStart, rangeEnd uint64) {
 	if rangeStart >= rangeEnd {
 		return
 	}
 
-	hbStart := toIntUnsigned(highbits(rangeStart))
-	lbStart := toIntUnsigned(lowbits(rangeStart))
-	hbLast := toIntUnsigned(highbits(rangeEnd - 1))
-	lbLast := toIntUnsigned(lowbits(rangeEnd - 1))
+	hbStart := int(rangeStart >> 16)
+	lbStart := uint32(rangeStart & 0xFFFF)
+	hbLast := int((rangeEnd - 1) >> 16)
+	lbLast := uint32((rangeEnd - 1) & 0xFFFF)
 
 	max := toIntUnsigned(maxLowBit())
-	for hb := uint16(hbStart); hb <= uint16(hbLast); hb++ {
+	rb.highlowcontainer.updateRange(hbStart, hbLast, func(hb uint16, c container) container {
 		containerStart := uint32(0)
-		if hb == uint16(hbStart) {
+		if int(hb) == hbStart {
 			containerStart = lbStart
 		}
 		containerLast := max
-		if hb == uint16(hbLast) {
+		if int(hb) == hbLast {
 			containerLast = lbLast
 		}
-
-		i := rb.highlowcontainer.getIndex(hb)
-
-		if i >= 0 {
-			c := rb.highlowcontainer.getContainerAtIndex(i).iaddRange(int(containerStart), int(containerLast+1))
-			rb.highlowcontainer.setContainerAtIndex(i, c)
-		} else { // *think* the range of ones must never be
-			// empty.
-			rb.highlowcontainer.insertNewKeyValueAt(-i-1, hb, rangeOfOnes(int(containerStart), int(containerLast)))
+		if c == nil {
+			return rangeOfOnes(int(containerStart), int(containerLast))
 		}
+		return c.iaddRange(int(containerStart), int(containerLast+1))
+	})
+}
+
+// AddRange64 is AddRange with a rangeEnd of at most 1<<32, so that the
+// largest uint32 can be included
+func (rb *RoaringBitmap) AddRange64(rangeStart, rangeEnd uint64) {
+	if rangeEnd > 1<<32 {
+		rangeEnd = 1 << 32
 	}
+	rb.addRange(rangeStart, rangeEnd)
 }
 
 // Remove the integers in [rangeStart, rangeEnd) from the bitmap
 func (rb *RoaringBitmap) RemoveRange(rangeStart, rangeEnd uint32) {
+	rb.removeRange(uint64(rangeStart), uint64(rangeEnd))
+}
+
+// removeRange is RemoveRange with bounds wide enough to reach 1<<32
+func (rb *RoaringBitmap) removeRange(rangeStart, rangeEnd uint64) {
 	if rangeStart >= rangeEnd {
 		return
 	}
 
-	hbStart := toIntUnsigned(highbits(rangeStart))
-	lbStart := toIntUnsigned(lowbits(rangeStart))
-	hbLast := toIntUnsigned(highbits(rangeEnd - 1))
-	lbLast := toIntUnsigned(lowbits(rangeEnd - 1))
+	hbStart := uint32(rangeStart >> 16)
+	lbStart := uint32(rangeStart & 0xFFFF)
+	hbLast := uint32((rangeEnd - 1) >> 16)
+	lbLast := uint32((rangeEnd - 1) & 0xFFFF)
 
 	max := toIntUnsigned(maxLowBit())
 
@@ -910,7 +1664,7 @@ func (rb *RoaringBitmap) RemoveRange(rangeStart, rangeEnd uint32) {
 		if i < 0 {
 			return
 		}
-		c := rb.highlowcontainer.getContainerAtIndex(i).iremoveRange(int(lbStart), int(lbLast+1))
+		c := rb.highlowcontainer.getWritableContainerAtIndex(i).iremoveRange(int(lbStart), int(lbLast+1))
 		if c.getCardinality() > 0 {
 			rb.highlowcontainer.setContainerAtIndex(i, c)
 		} else {
@@ -923,7 +1677,7 @@ func (rb *RoaringBitmap) RemoveRange(rangeStart, rangeEnd uint32) {
 
 	if ifirst >= 0 {
 		if lbStart != 0 {
-			c := rb.highlowcontainer.getContainerAtIndex(ifirst).iremoveRange(int(lbStart), int(max+1))
+			c := rb.highlowcontainer.getWritableContainerAtIndex(ifirst).iremoveRange(int(lbStart), int(max+1))
 			if c.getCardinality() > 0 {
 				rb.highlowcontainer.setContainerAtIndex(ifirst, c)
 				ifirst++
@@ -934,7 +1688,7 @@ func (rb *RoaringBitmap) RemoveRange(rangeStart, rangeEnd uint32) {
 	}
 	if ilast >= 0 {
 		if lbLast != max {
-			c := rb.highlowcontainer.getContainerAtIndex(ilast).iremoveRange(int(0), int(lbLast+1))
+			c := rb.highlowcontainer.getWritableContainerAtIndex(ilast).iremoveRange(int(0), int(lbLast+1))
 			if c.getCardinality() > 0 {
 				rb.highlowcontainer.setContainerAtIndex(ilast, c)
 			} else {
@@ -949,6 +1703,15 @@ func (rb *RoaringBitmap) RemoveRange(rangeStart, rangeEnd uint32) {
 	rb.highlowcontainer.removeIndexRange(ifirst, ilast)
 }
 
+// RemoveRange64 is RemoveRange with a rangeEnd of at most 1<<32, so that the
+// largest uint32 can be included
+func (rb *RoaringBitmap) RemoveRange64(rangeStart, rangeEnd uint64) {
+	if rangeEnd > 1<<32 {
+		rangeEnd = 1 << 32
+	}
+	rb.removeRange(rangeStart, rangeEnd)
+}
+
 // Flip negates the bits in the given range, any integer present in this range and in the bitmap is removed,
 // and any integer present in the range and not in the bitmap is added, a new bitmap is returned leaving
 // the current bitmap unchanged
@@ -967,7 +1730,8 @@ func Flip(bm *RoaringBitmap, rangeStart, rangeEnd uint32) *RoaringBitmap {
 	answer.highlowcontainer.appendCopiesUntil(bm.highlowcontainer, hbStart)
 
 	max := toIntUnsigned(maxLowBit())
-	for hb := hbStart; hb <= hbLast; hb++ {
+	for ihb := int(hbStart); ihb <= int(hbLast); ihb++ {
+		hb := uint16(ihb)
 		containerStart := uint32(0)
 		if hb == hbStart {
 			containerStart = toIntUnsigned(lbStart)
@@ -0,0 +1,666 @@
+package roaring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Roaring64Bitmap represents a compressed bitmap of 64-bit integers. The
+// high 32 bits of each integer select a RoaringBitmap holding its low 32
+// bits; these bitmaps are kept in a slice sorted by their high bits and
+// are never empty.
+type Roaring64Bitmap struct {
+	keys    []uint32
+	bitmaps []*RoaringBitmap
+}
+
+func highbits64(x uint64) uint32 {
+	return uint32(x >> 32)
+}
+
+func lowbits64(x uint64) uint32 {
+	return uint32(x)
+}
+
+// maxLowBits is the largest value held by one of the 32-bit bitmaps
+const maxLowBits = 1<<32 - 1
+
+// NewRoaring64Bitmap creates a new empty Roaring64Bitmap
+func NewRoaring64Bitmap() *Roaring64Bitmap {
+	return &Roaring64Bitmap{}
+}
+
+// BitmapOf64 generates a new 64-bit bitmap filled with the specified integers
+func BitmapOf64(dat ...uint64) *Roaring64Bitmap {
+	ans := NewRoaring64Bitmap()
+	for _, i := range dat {
+		ans.Add(i)
+	}
+	return ans
+}
+
+// getIndex returns the index of the bitmap with high bits x, or
+// -(insertion point)-1 when there is none
+func (rb *Roaring64Bitmap) getIndex(x uint32) int {
+	size := len(rb.keys)
+	if size == 0 || rb.keys[size-1] == x {
+		return size - 1
+	}
+	low := 0
+	high := size - 1
+	for low <= high {
+		middleIndex := int(uint(low+high) >> 1)
+		middleValue := rb.keys[middleIndex]
+		if middleValue < x {
+			low = middleIndex + 1
+		} else if middleValue > x {
+			high = middleIndex - 1
+		} else {
+			return middleIndex
+		}
+	}
+	return -(low + 1)
+}
+
+// getOrCreate returns the bitmap with high bits hb, inserting an empty one
+// if needed
+func (rb *Roaring64Bitmap) getOrCreate(hb uint32) *RoaringBitmap {
+	i := rb.getIndex(hb)
+	if i >= 0 {
+		return rb.bitmaps[i]
+	}
+	i = -i - 1
+	rb.keys = append(rb.keys, 0)
+	rb.bitmaps = append(rb.bitmaps, nil)
+	copy(rb.keys[i+1:], rb.keys[i:])
+	copy(rb.bitmaps[i+1:], rb.bitmaps[i:])
+	rb.keys[i] = hb
+	rb.bitmaps[i] = NewRoaringBitmap()
+	return rb.bitmaps[i]
+}
+
+// removeEmpty drops the empty bitmaps
+func (rb *Roaring64Bitmap) removeEmpty() {
+	n := 0
+	for i, bm := range rb.bitmaps {
+		if !bm.IsEmpty() {
+			rb.keys[n] = rb.keys[i]
+			rb.bitmaps[n] = bm
+			n++
+		}
+	}
+	for i := n; i < len(rb.bitmaps); i++ {
+		rb.bitmaps[i] = nil
+	}
+	rb.keys = rb.keys[:n]
+	rb.bitmaps = rb.bitmaps[:n]
+}
+
+// Clear removes all content from the Roaring64Bitmap
+func (rb *Roaring64Bitmap) Clear() {
+	rb.keys = nil
+	rb.bitmaps = nil
+}
+
+// Clone creates a copy of the Roaring64Bitmap
+func (rb *Roaring64Bitmap) Clone() *Roaring64Bitmap {
+	answer := &Roaring64Bitmap{
+		keys:    make([]uint32, len(rb.keys)),
+		bitmaps: make([]*RoaringBitmap, len(rb.bitmaps)),
+	}
+	copy(answer.keys, rb.keys)
+	for i, bm := range rb.bitmaps {
+		answer.bitmaps[i] = bm.Clone()
+	}
+	return answer
+}
+
+// Add the integer x to the bitmap
+func (rb *Roaring64Bitmap) Add(x uint64) {
+	rb.getOrCreate(highbits64(x)).Add(lowbits64(x))
+}
+
+// CheckedAdd adds the integer x to the bitmap and return true  if it was added (false if the integer was already present)
+func (rb *Roaring64Bitmap) CheckedAdd(x uint64) bool {
+	return rb.getOrCreate(highbits64(x)).CheckedAdd(lowbits64(x))
+}
+
+// Remove the integer x from the bitmap
+func (rb *Roaring64Bitmap) Remove(x uint64) {
+	rb.CheckedRemove(x)
+}
+
+// CheckedRemove removes the integer x from the bitmap and return true if the integer was effectively remove (and false if the integer was not present)
+func (rb *Roaring64Bitmap) CheckedRemove(x uint64) bool {
+	i := rb.getIndex(highbits64(x))
+	if i < 0 || !rb.bitmaps[i].CheckedRemove(lowbits64(x)) {
+		return false
+	}
+	if rb.bitmaps[i].IsEmpty() {
+		rb.removeEmpty()
+	}
+	return true
+}
+
+// Contains returns true if the integer is contained in the bitmap
+func (rb *Roaring64Bitmap) Contains(x uint64) bool {
+	i := rb.getIndex(highbits64(x))
+	return i >= 0 && rb.bitmaps[i].Contains(lowbits64(x))
+}
+
+// IsEmpty returns true if the Roaring64Bitmap is empty (it is faster than doing (GetCardinality() == 0))
+func (rb *Roaring64Bitmap) IsEmpty() bool {
+	return len(rb.keys) == 0
+}
+
+// GetCardinality returns the number of integers contained in the bitmap
+func (rb *Roaring64Bitmap) GetCardinality() uint64 {
+	size := uint64(0)
+	for _, bm := range rb.bitmaps {
+		size += bm.GetCardinality()
+	}
+	return size
+}
+
+// Equals returns true if the two bitmaps contain the same integers
+func (rb *Roaring64Bitmap) Equals(o interface{}) bool {
+	srb, ok := o.(*Roaring64Bitmap)
+	if !ok || len(srb.keys) != len(rb.keys) {
+		return false
+	}
+	for i, key := range rb.keys {
+		if srb.keys[i] != key || !srb.bitmaps[i].Equals(rb.bitmaps[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ToArray creates a new slice containing all of the integers stored in the Roaring64Bitmap in sorted order
+func (rb *Roaring64Bitmap) ToArray() []uint64 {
+	array := make([]uint64, 0, rb.GetCardinality())
+	for i := rb.Iterator(); i.HasNext(); {
+		array = append(array, i.Next())
+	}
+	return array
+}
+
+// String creates a string representation of the Roaring64Bitmap
+func (rb *Roaring64Bitmap) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("{")
+	i := rb.Iterator()
+	for i.HasNext() {
+		buffer.WriteString(strconv.FormatUint(i.Next(), 10))
+		if i.HasNext() {
+			buffer.WriteString(",")
+		}
+	}
+	buffer.WriteString("}")
+	return buffer.String()
+}
+
+// Rank returns the number of integers that are smaller or equal to x (Rank(infinity) would be GetCardinality())
+func (rb *Roaring64Bitmap) Rank(x uint64) uint64 {
+	size := uint64(0)
+	for i, key := range rb.keys {
+		if key > highbits64(x) {
+			return size
+		}
+		if key < highbits64(x) {
+			size += rb.bitmaps[i].GetCardinality()
+		} else if lowbits64(x) == maxLowBits {
+			// the uint32 Rank of a full 32-bit bitmap would wrap to 0
+			return size + rb.bitmaps[i].GetCardinality()
+		} else {
+			return size + uint64(rb.bitmaps[i].Rank(lowbits64(x)))
+		}
+	}
+	return size
+}
+
+// Select returns the xth integer in the bitmap
+func (rb *Roaring64Bitmap) Select(x uint64) (uint64, error) {
+	remaining := x
+	for i, bm := range rb.bitmaps {
+		card := bm.GetCardinality()
+		if remaining >= card {
+			remaining -= card
+		} else {
+			low, err := bm.Select(uint32(remaining))
+			return uint64(rb.keys[i])<<32 | uint64(low), err
+		}
+	}
+	return 0, fmt.Errorf("Can't find %dth integer in a bitmap with only %d items", x, rb.GetCardinality())
+}
+
+// Int64Iterable allows you to iterate over the values in a Roaring64Bitmap
+type Int64Iterable interface {
+	HasNext() bool
+	Next() uint64
+}
+
+type int64Iterator struct {
+	pos  int
+	hs   uint64
+	iter IntIterable
+	rb   *Roaring64Bitmap
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (ii *int64Iterator) HasNext() bool {
+	return ii.pos < len(ii.rb.keys)
+}
+
+func (ii *int64Iterator) init() {
+	if len(ii.rb.keys) > ii.pos {
+		ii.iter = ii.rb.bitmaps[ii.pos].Iterator()
+		ii.hs = uint64(ii.rb.keys[ii.pos]) << 32
+	}
+}
+
+// Next returns the next integer
+func (ii *int64Iterator) Next() uint64 {
+	x := uint64(ii.iter.Next()) | ii.hs
+	if !ii.iter.HasNext() {
+		ii.pos = ii.pos + 1
+		ii.init()
+	}
+	return x
+}
+
+// Iterator creates a new Int64Iterable to iterate over the integers contained in the bitmap, in sorted order
+func (rb *Roaring64Bitmap) Iterator() Int64Iterable {
+	p := &int64Iterator{rb: rb}
+	p.init()
+	return p
+}
+
+// forRange calls f with the high bits and the [start, end) low bits of
+// each of the 32-bit bitmaps overlapping [rangeStart, rangeLast]
+func forRange(rangeStart, rangeLast uint64, f func(hb uint32, start, end uint64)) {
+	if rangeStart > rangeLast {
+		return
+	}
+	hbStart := uint64(highbits64(rangeStart))
+	hbLast := uint64(highbits64(rangeLast))
+	for hb := hbStart; hb <= hbLast; hb++ {
+		start := uint64(0)
+		if hb == hbStart {
+			start = uint64(lowbits64(rangeStart))
+		}
+		end := uint64(1) << 32
+		if hb == hbLast {
+			end = uint64(lowbits64(rangeLast)) + 1
+		}
+		f(uint32(hb), start, end)
+	}
+}
+
+// AddRange adds the integers in [rangeStart, rangeEnd) to the bitmap
+func (rb *Roaring64Bitmap) AddRange(rangeStart, rangeEnd uint64) {
+	if rangeStart < rangeEnd {
+		rb.AddRangeClosed(rangeStart, rangeEnd-1)
+	}
+}
+
+// AddRangeClosed adds the integers in [rangeStart, rangeLast] to the bitmap,
+// so that the largest uint64 can be included
+func (rb *Roaring64Bitmap) AddRangeClosed(rangeStart, rangeLast uint64) {
+	forRange(rangeStart, rangeLast, func(hb uint32, start, end uint64) {
+		rb.getOrCreate(hb).addRange(start, end)
+	})
+}
+
+// RemoveRange removes the integers in [rangeStart, rangeEnd) from the bitmap
+func (rb *Roaring64Bitmap) RemoveRange(rangeStart, rangeEnd uint64) {
+	if rangeStart < rangeEnd {
+		rb.RemoveRangeClosed(rangeStart, rangeEnd-1)
+	}
+}
+
+// RemoveRangeClosed removes the integers in [rangeStart, rangeLast] from the
+// bitmap, so that the largest uint64 can be included
+func (rb *Roaring64Bitmap) RemoveRangeClosed(rangeStart, rangeLast uint64) {
+	forRange(rangeStart, rangeLast, func(hb uint32, start, end uint64) {
+		if i := rb.getIndex(hb); i >= 0 {
+			rb.bitmaps[i].removeRange(start, end)
+		}
+	})
+	rb.removeEmpty()
+}
+
+// Flip negates the bits in the given range, any integer present in this range and in the bitmap is removed,
+// and any integer present in the range and not in the bitmap is added
+func (rb *Roaring64Bitmap) Flip(rangeStart, rangeEnd uint64) {
+	if rangeStart < rangeEnd {
+		rb.FlipClosed(rangeStart, rangeEnd-1)
+	}
+}
+
+// FlipClosed is Flip over [rangeStart, rangeLast], so that the largest uint64
+// can be included
+func (rb *Roaring64Bitmap) FlipClosed(rangeStart, rangeLast uint64) {
+	forRange(rangeStart, rangeLast, func(hb uint32, start, end uint64) {
+		rb.getOrCreate(hb).flip(start, end)
+	})
+	rb.removeEmpty()
+}
+
+// RunOptimize converts the containers of each 32-bit bitmap to their most
+// compact representation, see RoaringBitmap.RunOptimize
+func (rb *Roaring64Bitmap) RunOptimize() {
+	for _, bm := range rb.bitmaps {
+		bm.RunOptimize()
+	}
+}
+
+// HasRunCompression returns true if the bitmap holds at least one run container
+func (rb *Roaring64Bitmap) HasRunCompression() bool {
+	for _, bm := range rb.bitmaps {
+		if bm.HasRunCompression() {
+			return true
+		}
+	}
+	return false
+}
+
+// And computes the intersection between two bitmaps and stores the result in the current bitmap
+func (rb *Roaring64Bitmap) And(x2 *Roaring64Bitmap) {
+	pos1, pos2 := 0, 0
+	for pos1 < len(rb.keys) && pos2 < len(x2.keys) {
+		s1, s2 := rb.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			rb.bitmaps[pos1].Clear()
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			rb.bitmaps[pos1].And(x2.bitmaps[pos2])
+			pos1++
+			pos2++
+		}
+	}
+	for ; pos1 < len(rb.keys); pos1++ {
+		rb.bitmaps[pos1].Clear()
+	}
+	rb.removeEmpty()
+}
+
+// Or computes the union between two bitmaps and stores the result in the current bitmap
+func (rb *Roaring64Bitmap) Or(x2 *Roaring64Bitmap) {
+	rb.merge(x2, func(bm1, bm2 *RoaringBitmap) { bm1.Or(bm2) })
+}
+
+// Xor computes the symmetric difference between two bitmaps and stores the result in the current bitmap
+func (rb *Roaring64Bitmap) Xor(x2 *Roaring64Bitmap) {
+	rb.merge(x2, func(bm1, bm2 *RoaringBitmap) { bm1.Xor(bm2) })
+	rb.removeEmpty()
+}
+
+// merge adds the bitmaps of x2 missing from rb, and applies op to the
+// bitmaps having the same high bits
+func (rb *Roaring64Bitmap) merge(x2 *Roaring64Bitmap, op func(bm1, bm2 *RoaringBitmap)) {
+	keys := make([]uint32, 0, len(rb.keys)+len(x2.keys))
+	bitmaps := make([]*RoaringBitmap, 0, len(rb.keys)+len(x2.keys))
+	pos1, pos2 := 0, 0
+	for pos1 < len(rb.keys) || pos2 < len(x2.keys) {
+		if pos2 == len(x2.keys) || (pos1 < len(rb.keys) && rb.keys[pos1] < x2.keys[pos2]) {
+			keys = append(keys, rb.keys[pos1])
+			bitmaps = append(bitmaps, rb.bitmaps[pos1])
+			pos1++
+		} else if pos1 == len(rb.keys) || rb.keys[pos1] > x2.keys[pos2] {
+			keys = append(keys, x2.keys[pos2])
+			bitmaps = append(bitmaps, x2.bitmaps[pos2].Clone())
+			pos2++
+		} else {
+			op(rb.bitmaps[pos1], x2.bitmaps[pos2])
+			keys = append(keys, rb.keys[pos1])
+			bitmaps = append(bitmaps, rb.bitmaps[pos1])
+			pos1++
+			pos2++
+		}
+	}
+	rb.keys = keys
+	rb.bitmaps = bitmaps
+}
+
+// AndNot computes the difference between two bitmaps and stores the result in the current bitmap
+func (rb *Roaring64Bitmap) AndNot(x2 *Roaring64Bitmap) {
+	pos1, pos2 := 0, 0
+	for pos1 < len(rb.keys) && pos2 < len(x2.keys) {
+		s1, s2 := rb.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			rb.bitmaps[pos1].AndNot(x2.bitmaps[pos2])
+			pos1++
+			pos2++
+		}
+	}
+	rb.removeEmpty()
+}
+
+// Intersects checks whether two bitmap intersects, bitmaps are not modified
+func (rb *Roaring64Bitmap) Intersects(x2 *Roaring64Bitmap) bool {
+	pos1, pos2 := 0, 0
+	for pos1 < len(rb.keys) && pos2 < len(x2.keys) {
+		s1, s2 := rb.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			if rb.bitmaps[pos1].Intersects(x2.bitmaps[pos2]) {
+				return true
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return false
+}
+
+// And64 computes the intersection between two bitmaps and returns the result
+func And64(x1, x2 *Roaring64Bitmap) *Roaring64Bitmap {
+	answer := NewRoaring64Bitmap()
+	pos1, pos2 := 0, 0
+	for pos1 < len(x1.keys) && pos2 < len(x2.keys) {
+		s1, s2 := x1.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			bm := And(x1.bitmaps[pos1], x2.bitmaps[pos2])
+			if !bm.IsEmpty() {
+				answer.keys = append(answer.keys, s1)
+				answer.bitmaps = append(answer.bitmaps, bm)
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return answer
+}
+
+// Or64 computes the union between two bitmaps and returns the result
+func Or64(x1, x2 *Roaring64Bitmap) *Roaring64Bitmap {
+	answer := x1.Clone()
+	answer.Or(x2)
+	return answer
+}
+
+// Xor64 computes the symmetric difference between two bitmaps and returns the result
+func Xor64(x1, x2 *Roaring64Bitmap) *Roaring64Bitmap {
+	answer := x1.Clone()
+	answer.Xor(x2)
+	return answer
+}
+
+// AndNot64 computes the difference between two bitmaps and returns the result
+func AndNot64(x1, x2 *Roaring64Bitmap) *Roaring64Bitmap {
+	answer := x1.Clone()
+	answer.AndNot(x2)
+	return answer
+}
+
+// FastOr64 computes the union between many bitmaps quickly, merging the
+// 32-bit bitmaps sharing the same high bits with FastHorizontalOr
+func FastOr64(bitmaps ...*Roaring64Bitmap) *Roaring64Bitmap {
+	answer := NewRoaring64Bitmap()
+	pos := make([]int, len(bitmaps))
+	for {
+		found := false
+		var key uint32
+		for i, bm := range bitmaps {
+			if pos[i] < len(bm.keys) && (!found || bm.keys[pos[i]] < key) {
+				found, key = true, bm.keys[pos[i]]
+			}
+		}
+		if !found {
+			return answer
+		}
+		var inner []*RoaringBitmap
+		for i, bm := range bitmaps {
+			if pos[i] < len(bm.keys) && bm.keys[pos[i]] == key {
+				inner = append(inner, bm.bitmaps[pos[i]])
+				pos[i]++
+			}
+		}
+		answer.keys = append(answer.keys, key)
+		answer.bitmaps = append(answer.bitmaps, FastHorizontalOr(inner...))
+	}
+}
+
+// FastAnd64 computes the intersection between many bitmaps quickly, using
+// FastAnd on the 32-bit bitmaps sharing the same high bits
+func FastAnd64(bitmaps ...*Roaring64Bitmap) *Roaring64Bitmap {
+	answer := NewRoaring64Bitmap()
+	if len(bitmaps) == 0 {
+		return answer
+	}
+	inner := make([]*RoaringBitmap, len(bitmaps))
+main:
+	for i, key := range bitmaps[0].keys {
+		inner[0] = bitmaps[0].bitmaps[i]
+		for j, bm := range bitmaps[1:] {
+			k := bm.getIndex(key)
+			if k < 0 {
+				continue main
+			}
+			inner[j+1] = bm.bitmaps[k]
+		}
+		result := FastAnd(inner...)
+		if !result.IsEmpty() {
+			answer.keys = append(answer.keys, key)
+			answer.bitmaps = append(answer.bitmaps, result)
+		}
+	}
+	return answer
+}
+
+// GetSerializedSizeInBytes computes the serialized size in bytes of the Roaring64Bitmap. It should correspond to the
+// number of bytes written when invoking WriteTo
+func (rb *Roaring64Bitmap) GetSerializedSizeInBytes() uint64 {
+	size := uint64(8)
+	for _, bm := range rb.bitmaps {
+		size += 4 + bm.GetSerializedSizeInBytes()
+	}
+	return size
+}
+
+// WriteTo writes a serialized version of this bitmap to stream, in the
+// portable format shared with the Java and C implementations: the number
+// of 32-bit bitmaps as a uint64, then the high bits of each as a uint32
+// followed by its portable 32-bit serialization, all in little-endian
+func (rb *Roaring64Bitmap) WriteTo(stream io.Writer) (int64, error) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(len(rb.keys)))
+	written, err := stream.Write(buf[:])
+	n := int64(written)
+	if err != nil {
+		return n, err
+	}
+	for i, bm := range rb.bitmaps {
+		binary.LittleEndian.PutUint32(buf[:], rb.keys[i])
+		written, err := stream.Write(buf[:4])
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+		written, err = bm.WriteTo(stream)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads a serialized version of this bitmap from stream, as
+// written by WriteTo. Malformed input is rejected with ErrInvalidCookie,
+// ErrTruncated or ErrCorrupt, leaving the bitmap empty.
+func (rb *Roaring64Bitmap) ReadFrom(stream io.Reader) (offset int64, err error) {
+	rb.Clear()
+	defer func() {
+		if err != nil {
+			rb.Clear()
+		}
+	}()
+
+	var buf [8]byte
+	n, err := io.ReadFull(stream, buf[:])
+	offset += int64(n)
+	if err != nil {
+		return offset, truncated(err)
+	}
+	size := binary.LittleEndian.Uint64(buf[:])
+	if size > 1<<32 {
+		return offset, fmt.Errorf("%w: %d bitmaps", ErrCorrupt, size)
+	}
+	var previous uint32
+	for i := uint64(0); i < size; i++ {
+		n, err = io.ReadFull(stream, buf[:4])
+		offset += int64(n)
+		if err != nil {
+			return offset, fmt.Errorf("bitmap %d: %w", i, truncated(err))
+		}
+		key := binary.LittleEndian.Uint32(buf[:])
+		if i > 0 && key <= previous {
+			return offset, fmt.Errorf("%w: keys are not strictly increasing at bitmap %d", ErrCorrupt, i)
+		}
+		previous = key
+		bm := NewRoaringBitmap()
+		n, err = bm.ReadFrom(stream)
+		offset += int64(n)
+		if err != nil {
+			return offset, fmt.Errorf("bitmap %d: %w", i, err)
+		}
+		if !bm.IsEmpty() {
+			rb.keys = append(rb.keys, key)
+			rb.bitmaps = append(rb.bitmaps, bm)
+		}
+	}
+	return offset, nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface, using
+// the same portable format as WriteTo
+func (rb *Roaring64Bitmap) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	_, err := rb.WriteTo(buf)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface,
+// replacing the content of the bitmap with a copy of data
+func (rb *Roaring64Bitmap) UnmarshalBinary(data []byte) error {
+	_, err := rb.ReadFrom(bytes.NewReader(data))
+	return err
+}
@@ -0,0 +1,278 @@
+package roaring
+
+// to run just these tests: go test -run TestRoaring64*
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// reference64 is a naive set used to check Roaring64Bitmap
+type reference64 map[uint64]bool
+
+func (r reference64) sorted() []uint64 {
+	answer := make([]uint64, 0, len(r))
+	for x := range r {
+		answer = append(answer, x)
+	}
+	sort.Slice(answer, func(i, j int) bool { return answer[i] < answer[j] })
+	return answer
+}
+
+func checkReference64(t *testing.T, rb *Roaring64Bitmap, r reference64) {
+	t.Helper()
+	expected := r.sorted()
+	got := rb.ToArray()
+	if len(got) != len(expected) || rb.GetCardinality() != uint64(len(expected)) {
+		t.Fatalf("Bad cardinality %d, expected %d", len(got), len(expected))
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("Bad value %d at %d, expected %d", got[i], i, expected[i])
+		}
+	}
+	for _, bm := range rb.bitmaps {
+		if bm.IsEmpty() {
+			t.Fatalf("Empty inner bitmap")
+		}
+	}
+}
+
+// random64 picks values clustered around a few high keys, including the
+// edges of the 32-bit and 64-bit spaces
+func random64(r *rand.Rand) uint64 {
+	highs := []uint64{0, 1, 2, 1000, 1<<32 - 1}
+	return highs[r.Intn(len(highs))]<<32 | uint64(r.Intn(4))<<30 | uint64(r.Intn(1<<20))
+}
+
+func randomBitmap64(r *rand.Rand, n int) (*Roaring64Bitmap, reference64) {
+	rb := NewRoaring64Bitmap()
+	ref := make(reference64)
+	for i := 0; i < n; i++ {
+		x := random64(r)
+		rb.Add(x)
+		ref[x] = true
+	}
+	return rb, ref
+}
+
+func TestRoaring64AddRemove(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	rb, ref := randomBitmap64(r, 10000)
+	checkReference64(t, rb, ref)
+	for x := range ref {
+		if !rb.Contains(x) || rb.CheckedAdd(x) {
+			t.Fatalf("Missing %d", x)
+		}
+	}
+	for i := 0; i < 20000; i++ {
+		x := random64(r)
+		if rb.CheckedRemove(x) != ref[x] {
+			t.Fatalf("Bad CheckedRemove(%d)", x)
+		}
+		delete(ref, x)
+	}
+	checkReference64(t, rb, ref)
+	rb.Add(1<<64 - 1)
+	if !rb.Contains(1<<64-1) || rb.Contains(1<<64-2) {
+		t.Errorf("Bad top value")
+	}
+}
+
+func TestRoaring64Ranges(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 30; i++ {
+		rb, ref := randomBitmap64(r, 1000)
+		start := random64(r)
+		end := start + uint64(r.Intn(3<<16))
+		if r.Intn(4) == 0 {
+			// crossing the boundary between two 32-bit bitmaps
+			start = (start | (1<<32 - 1)) - uint64(r.Intn(1<<17))
+			end = start + uint64(r.Intn(1<<18))
+		}
+		if end < start {
+			end = 1<<64 - 1
+		}
+		var op func(start, end uint64)
+		switch i % 3 {
+		case 0:
+			op = rb.AddRange
+			for x := start; x < end; x++ {
+				ref[x] = true
+			}
+		case 1:
+			op = rb.RemoveRange
+			for x := start; x < end; x++ {
+				delete(ref, x)
+			}
+		case 2:
+			op = rb.Flip
+			for x := start; x < end; x++ {
+				if ref[x] {
+					delete(ref, x)
+				} else {
+					ref[x] = true
+				}
+			}
+		}
+		op(start, end)
+		checkReference64(t, rb, ref)
+	}
+	rb := NewRoaring64Bitmap()
+	rb.AddRange(1<<32-10, 1<<32+10)
+	if rb.GetCardinality() != 20 || len(rb.keys) != 2 || !rb.Contains(1<<32-1) {
+		t.Errorf("Bad range across 32-bit bitmaps")
+	}
+	rb.Flip(1<<32-10, 1<<32+10)
+	if !rb.IsEmpty() {
+		t.Errorf("Flipping the range back should empty the bitmap")
+	}
+
+	rb.AddRangeClosed(1<<64-10, 1<<64-1)
+	if rb.GetCardinality() != 10 || !rb.Contains(1<<64-1) {
+		t.Errorf("Bad closed range at the top of the key space")
+	}
+	rb.RemoveRangeClosed(1<<64-5, 1<<64-1)
+	if rb.GetCardinality() != 5 || rb.Contains(1<<64-1) {
+		t.Errorf("Bad closed removal at the top of the key space")
+	}
+	rb.FlipClosed(1<<64-10, 1<<64-1)
+	if rb.GetCardinality() != 5 || !rb.Contains(1<<64-1) || rb.Contains(1<<64-10) {
+		t.Errorf("Bad closed flip at the top of the key space")
+	}
+	rb.AddRangeClosed(5, 4)
+	if rb.GetCardinality() != 5 {
+		t.Errorf("Empty closed range should not add anything")
+	}
+}
+
+func TestRoaring64Operations(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 20; i++ {
+		rb1, ref1 := randomBitmap64(r, 2000)
+		rb2, ref2 := randomBitmap64(r, 2000)
+		and, or, xor, andNot := make(reference64), make(reference64), make(reference64), make(reference64)
+		for x := range ref1 {
+			or[x] = true
+			if ref2[x] {
+				and[x] = true
+			} else {
+				xor[x] = true
+				andNot[x] = true
+			}
+		}
+		for x := range ref2 {
+			or[x] = true
+			if !ref1[x] {
+				xor[x] = true
+			}
+		}
+		checkReference64(t, And64(rb1, rb2), and)
+		checkReference64(t, Or64(rb1, rb2), or)
+		checkReference64(t, Xor64(rb1, rb2), xor)
+		checkReference64(t, AndNot64(rb1, rb2), andNot)
+		checkReference64(t, FastAnd64(rb1, rb2, rb1), and)
+		checkReference64(t, FastOr64(rb1, rb2, rb1), or)
+		checkReference64(t, rb1, ref1)
+		checkReference64(t, rb2, ref2)
+		if rb1.Intersects(rb2) != (len(and) > 0) {
+			t.Fatalf("Bad Intersects")
+		}
+		inplace := rb1.Clone()
+		inplace.And(rb2)
+		checkReference64(t, inplace, and)
+		inplace = rb1.Clone()
+		inplace.Or(rb2)
+		checkReference64(t, inplace, or)
+		inplace = rb1.Clone()
+		inplace.Xor(rb2)
+		checkReference64(t, inplace, xor)
+		inplace = rb1.Clone()
+		inplace.AndNot(rb2)
+		checkReference64(t, inplace, andNot)
+		checkReference64(t, rb2, ref2)
+	}
+	if !FastOr64().IsEmpty() || !FastAnd64().IsEmpty() {
+		t.Errorf("Aggregating nothing should give an empty bitmap")
+	}
+}
+
+func TestRoaring64RankSelect(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	rb, ref := randomBitmap64(r, 5000)
+	values := ref.sorted()
+	for i, x := range values {
+		if rb.Rank(x) != uint64(i+1) {
+			t.Fatalf("Bad Rank(%d)", x)
+		}
+		v, err := rb.Select(uint64(i))
+		if err != nil || v != x {
+			t.Fatalf("Bad Select(%d)", i)
+		}
+	}
+	if rb.Rank(1<<64-1) != uint64(len(values)) {
+		t.Errorf("Bad Rank of the top value")
+	}
+	if _, err := rb.Select(uint64(len(values))); err == nil {
+		t.Errorf("Select past the end should fail")
+	}
+
+	full := BitmapOf64(1<<32 - 1)
+	full.getOrCreate(1).Complement()
+	if full.Rank(2<<32-1) != 1<<32+1 || full.Rank(3<<32) != 1<<32+1 || full.Rank(2<<32-2) != 1<<32 {
+		t.Errorf("Bad Rank over a full 32-bit bitmap")
+	}
+}
+
+func TestRoaring64Serialization(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	rb, _ := randomBitmap64(r, 5000)
+	rb.AddRange(5<<32, 5<<32+100000)
+	rb.RunOptimize()
+	buf := new(bytes.Buffer)
+	n, err := rb.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("Failed writing: %v", err)
+	}
+	if n != int64(buf.Len()) || uint64(n) != rb.GetSerializedSizeInBytes() {
+		t.Errorf("Bad GetSerializedSizeInBytes")
+	}
+	data := buf.Bytes()
+	if binary.LittleEndian.Uint64(data) != uint64(len(rb.keys)) || binary.LittleEndian.Uint32(data[8:]) != rb.keys[0] {
+		t.Errorf("Bad header")
+	}
+	newrb := BitmapOf64(42)
+	if n, err = newrb.ReadFrom(bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+		t.Fatalf("Failed reading: %v", err)
+	}
+	var _ io.WriterTo = rb
+	var _ io.ReaderFrom = newrb
+	if !rb.Equals(newrb) {
+		t.Errorf("Cannot retrieve serialized version")
+	}
+	for l := 0; l < len(data); l += 1 + l/10 {
+		_, err = newrb.ReadFrom(bytes.NewReader(data[:l]))
+		if !errors.Is(err, ErrTruncated) || !newrb.IsEmpty() {
+			t.Fatalf("Reading %d of %d bytes gave %v", l, len(data), err)
+		}
+	}
+
+	// two 32-bit bitmaps {1} with high bits 7 then 3
+	unsorted := []byte{2, 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0}
+	inner, _ := BitmapOf(1).MarshalBinary()
+	unsorted = append(unsorted, inner...)
+	unsorted = append(unsorted, 3, 0, 0, 0)
+	unsorted = append(unsorted, inner...)
+	if err = newrb.UnmarshalBinary(unsorted); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Unsorted keys gave %v", err)
+	}
+	unsorted[len(unsorted)-len(inner)-4] = 8
+	if err = newrb.UnmarshalBinary(unsorted); err != nil || newrb.String() != "{30064771073,34359738369}" {
+		t.Errorf("Cannot read hand-made bitmap %v: %v", newrb, err)
+	}
+}
@@ -1,6 +1,7 @@
 package roaring
 
 import (
+	"bytes"
 	"log"
 	"math/rand"
 	"strconv"
@@ -1577,3 +1578,720 @@ func TestAndNot(t *testing.T) {
 		So(correct.Equals(rr), ShouldEqual, true)
 	})
 }
+
+func TestRunOptimize(t *testing.T) {
+	Convey("RunOptimize", t, func() {
+		rb := NewRoaringBitmap()
+		rb.AddRange(0, 65536)
+		rb.AddRange(100000, 100010)
+		rb.AddRange(200000, 300000)
+		for i := uint32(400000); i < 500000; i += 3 {
+			rb.Add(i)
+		}
+		rb.Add(600000)
+		So(rb.HasRunCompression(), ShouldBeFalse)
+
+		before := rb.Clone()
+		size := rb.GetSizeInBytes()
+		rb.RunOptimize()
+		So(rb.HasRunCompression(), ShouldBeTrue)
+		So(rb.GetSizeInBytes(), ShouldBeLessThan, size)
+		So(rb.Equals(before), ShouldBeTrue)
+		So(before.Equals(rb), ShouldBeTrue)
+		So(rb.GetCardinality(), ShouldEqual, before.GetCardinality())
+		So(IntsEquals(rb.ToArray(), before.ToArray()), ShouldBeTrue)
+
+		_, ok := rb.highlowcontainer.getContainer(0).(*runContainer)
+		So(ok, ShouldBeTrue)
+		_, ok = rb.highlowcontainer.getContainer(6).(*bitmapContainer)
+		So(ok, ShouldBeTrue)
+		_, ok = rb.highlowcontainer.getContainer(9).(*arrayContainer)
+		So(ok, ShouldBeTrue)
+
+		// already optimal
+		c := rb.highlowcontainer.getContainer(0)
+		rb.RunOptimize()
+		So(rb.highlowcontainer.getContainer(0), ShouldEqual, c)
+
+		// operations on run containers agree with the unoptimized bitmap
+		other := BitmapOf(5, 70000, 100005, 250000, 400003, 600000, 700000)
+		So(And(rb, other).Equals(And(before, other)), ShouldBeTrue)
+		So(Or(rb, other).Equals(Or(before, other)), ShouldBeTrue)
+		So(Xor(rb, other).Equals(Xor(before, other)), ShouldBeTrue)
+		So(AndNot(rb, other).Equals(AndNot(before, other)), ShouldBeTrue)
+		So(AndNot(other, rb).Equals(AndNot(other, before)), ShouldBeTrue)
+		So(rb.Rank(250000), ShouldEqual, before.Rank(250000))
+
+		// the optimized bitmap still serializes
+		buf := new(bytes.Buffer)
+		_, err := rb.WriteTo(buf)
+		So(err, ShouldBeNil)
+		So(buf.Len(), ShouldEqual, rb.GetSerializedSizeInBytes())
+		newrb := NewRoaringBitmap()
+		_, err = newrb.ReadFrom(buf)
+		So(err, ShouldBeNil)
+		So(newrb.Equals(before), ShouldBeTrue)
+	})
+}
+
+func TestNumberOfRuns(t *testing.T) {
+	Convey("numberOfRuns", t, func() {
+		ac := newArrayContainerRange(10, 20)
+		ac.add(30)
+		ac.add(65535)
+		So(ac.numberOfRuns(), ShouldEqual, 3)
+		bc := ac.toBitmapContainer()
+		So(bc.numberOfRuns(), ShouldEqual, 3)
+		bc.iaddRange(63, 65)
+		bc.iaddRange(127, 129)
+		So(bc.numberOfRuns(), ShouldEqual, 5)
+		So(newRunContainerFromBitmap(bc).numberOfRuns(), ShouldEqual, 5)
+	})
+}
+
+func TestReverseIterator(t *testing.T) {
+	Convey("reverse iterator", t, func() {
+		rb := BitmapOf(1, 2, 3, 100000, 4294967295)
+		rb.AddRange(200000, 300000)
+		for i := 500000; i < 600000; i += 3 {
+			rb.AddInt(i)
+		}
+		for _, optimize := range []bool{false, true} {
+			if optimize {
+				rb.RunOptimize()
+			}
+			values := rb.ToArray()
+			i := len(values) - 1
+			for it := rb.ReverseIterator(); it.HasNext(); i-- {
+				So(i, ShouldBeGreaterThanOrEqualTo, 0)
+				So(it.Next(), ShouldEqual, values[i])
+			}
+			So(i, ShouldEqual, -1)
+		}
+		So(NewRoaringBitmap().ReverseIterator().HasNext(), ShouldBeFalse)
+	})
+}
+
+func TestPeekableIterator(t *testing.T) {
+	Convey("peekable iterator", t, func() {
+		r := rand.New(rand.NewSource(1))
+		rb := BitmapOf(1, 2, 3, 100000, 4294967295)
+		rb.AddRange(200000, 300000)
+		for i := 500000; i < 600000; i += 3 {
+			rb.AddInt(i)
+		}
+		for i := 0; i < 1000; i++ {
+			rb.AddInt(r.Intn(10000000))
+		}
+		for _, optimize := range []bool{false, true} {
+			if optimize {
+				rb.RunOptimize()
+			}
+			values := rb.ToArray()
+			it := rb.Iterator()
+			pos := 0
+			for it.HasNext() {
+				minval := values[pos] + uint32(r.Intn(100000))
+				if r.Intn(3) == 0 {
+					minval = values[pos] - uint32(r.Intn(10))
+				}
+				it.AdvanceIfNeeded(minval)
+				for pos < len(values) && values[pos] < minval {
+					pos++
+				}
+				if pos == len(values) {
+					So(it.HasNext(), ShouldBeFalse)
+					break
+				}
+				So(it.HasNext(), ShouldBeTrue)
+				So(it.PeekNext(), ShouldEqual, values[pos])
+				So(it.Next(), ShouldEqual, values[pos])
+				pos++
+			}
+			it = rb.Iterator()
+			it.AdvanceIfNeeded(4294967295)
+			So(it.Next(), ShouldEqual, uint32(4294967295))
+			So(it.HasNext(), ShouldBeFalse)
+			it.AdvanceIfNeeded(0)
+			So(it.HasNext(), ShouldBeFalse)
+		}
+	})
+}
+
+func TestManyIterator(t *testing.T) {
+	Convey("many iterator", t, func() {
+		rb := BitmapOf(1, 2, 3, 100000, 4294967295)
+		rb.AddRange(200000, 300000)
+		for i := 500000; i < 600000; i += 3 {
+			rb.AddInt(i)
+		}
+		for _, optimize := range []bool{false, true} {
+			if optimize {
+				rb.RunOptimize()
+			}
+			values := rb.ToArray()
+			for _, size := range []int{1, 7, 64, 4096, 1 << 20} {
+				buf := make([]uint32, size)
+				got := make([]uint32, 0, len(values))
+				it := rb.ManyIterator()
+				for n := it.NextMany(buf); n > 0; n = it.NextMany(buf) {
+					got = append(got, buf[:n]...)
+				}
+				So(got, ShouldResemble, values)
+				So(it.NextMany(buf), ShouldEqual, 0)
+			}
+		}
+		So(NewRoaringBitmap().ManyIterator().NextMany(make([]uint32, 10)), ShouldEqual, 0)
+	})
+	Convey("many iterator does not allocate", t, func() {
+		rb := BitmapOf(1, 2, 3)
+		rb.AddRange(200000, 300000)
+		rb.AddRange(400000, 401000)
+		rb.RunOptimize()
+		rb.AddRange(500000, 510000)
+		buf := make([]uint32, 1000)
+		it := rb.ManyIterator()
+		allocs := testing.AllocsPerRun(100, func() {
+			it.NextMany(buf)
+		})
+		So(allocs, ShouldEqual, 0)
+	})
+}
+
+func TestIterate(t *testing.T) {
+	Convey("iterate with callback", t, func() {
+		rb := BitmapOf(1, 2, 3, 100000, 4294967295)
+		rb.AddRange(200000, 300000)
+		for i := 500000; i < 600000; i += 3 {
+			rb.AddInt(i)
+		}
+		for _, optimize := range []bool{false, true} {
+			if optimize {
+				rb.RunOptimize()
+			}
+			var got []uint32
+			rb.Iterate(func(x uint32) bool {
+				got = append(got, x)
+				return true
+			})
+			So(got, ShouldResemble, rb.ToArray())
+			n := 0
+			rb.Iterate(func(x uint32) bool {
+				n++
+				return x < 200010
+			})
+			So(n, ShouldEqual, 4+11)
+		}
+		NewRoaringBitmap().Iterate(func(x uint32) bool {
+			panic("should never happen")
+		})
+	})
+}
+
+func TestRanges(t *testing.T) {
+	Convey("range iterator and ToRanges", t, func() {
+		rb := BitmapOf(1, 2, 3, 5, 65535, 65536, 65537)
+		rb.AddRange(100, 200)
+		rb.AddRange(1<<17-10, 1<<18+10)
+		rb.AddRange(1<<20-1, 1<<20)
+		rb.AddRange(1<<20+1, 1<<20+3)
+		for i := 500000; i < 500020; i += 2 {
+			rb.AddInt(i)
+		}
+		expected := [][2]uint32{{1, 3}, {5, 5}, {100, 199}, {65535, 65537}, {1<<17 - 10, 1<<18 + 9}}
+		for i := 500000; i < 500020; i += 2 {
+			expected = append(expected, [2]uint32{uint32(i), uint32(i)})
+		}
+		expected = append(expected, [2]uint32{1<<20 - 1, 1<<20 - 1}, [2]uint32{1<<20 + 1, 1<<20 + 2})
+		for _, optimize := range []bool{false, true} {
+			if optimize {
+				rb.RunOptimize()
+			}
+			So(rb.ToRanges(), ShouldResemble, expected)
+			var got [][2]uint32
+			for it := rb.RangeIterator(); it.HasNext(); {
+				start, last := it.Next()
+				got = append(got, [2]uint32{start, last})
+			}
+			So(got, ShouldResemble, expected)
+			So(FromRanges(expected).Equals(rb), ShouldBeTrue)
+		}
+	})
+	Convey("ranges at the edges", t, func() {
+		So(NewRoaringBitmap().ToRanges(), ShouldBeEmpty)
+		So(NewRoaringBitmap().RangeIterator().HasNext(), ShouldBeFalse)
+		So(FromRanges(nil).IsEmpty(), ShouldBeTrue)
+		rb := BitmapOf(0, 4294967295)
+		rb.AddRange(4294967295-70000, 4294967295)
+		So(rb.ToRanges(), ShouldResemble, [][2]uint32{{0, 0}, {4294967295 - 70000, 4294967295}})
+		it := rb.RangeIterator()
+		it.Next()
+		start, last := it.Next()
+		So(start, ShouldEqual, 4294967295-70000)
+		So(last, ShouldEqual, 4294967295)
+		So(it.HasNext(), ShouldBeFalse)
+		So(FromRanges(rb.ToRanges()).Equals(rb), ShouldBeTrue)
+		full := FromRanges([][2]uint32{{0, 4294967295}})
+		So(full.GetCardinality(), ShouldEqual, uint64(1)<<32)
+		So(full.ToRanges(), ShouldResemble, [][2]uint32{{0, 4294967295}})
+		So(FromRanges([][2]uint32{{7, 7}}).ToArray(), ShouldResemble, []uint32{7})
+	})
+}
+
+func TestNextPreviousValue(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	rb := NewRoaringBitmap()
+	for i := 0; i < 2000; i++ {
+		rb.AddInt(r.Intn(1 << 18))
+	}
+	rb.AddRange(1<<18, 3<<17)
+	rb.AddRange(3<<17+10, 3<<17+1000)
+	for i := 0; i < 10000; i++ {
+		rb.AddInt(1<<19 + r.Intn(1<<16))
+	}
+	rb.AddRange(1<<20, 1<<20+1<<16)
+	rb.Add(1<<20 + 1<<17 + 5)
+	if _, err := NewRoaringBitmap().Minimum(); err == nil {
+		t.Errorf("Minimum of an empty bitmap should fail")
+	}
+	if _, err := NewRoaringBitmap().Maximum(); err == nil {
+		t.Errorf("Maximum of an empty bitmap should fail")
+	}
+	for _, optimize := range []bool{false, true} {
+		if optimize {
+			rb.RunOptimize()
+		}
+		values := rb.ToArray()
+		if min, err := rb.Minimum(); err != nil || min != values[0] {
+			t.Errorf("Bad minimum %d", min)
+		}
+		if max, err := rb.Maximum(); err != nil || max != values[len(values)-1] {
+			t.Errorf("Bad maximum %d", max)
+		}
+		limit := int64(values[len(values)-1]) + 2
+		next, previous := int64(-1), int64(-1)
+		nextAbsent := make([]int64, limit+1)
+		nextAbsent[limit] = limit
+		for x := limit - 1; x >= 0; x-- {
+			if rb.Contains(uint32(x)) {
+				nextAbsent[x] = nextAbsent[x+1]
+			} else {
+				nextAbsent[x] = x
+			}
+		}
+		previousAbsent := int64(-1)
+		for x := int64(0); x < limit; x++ {
+			if rb.Contains(uint32(x)) {
+				previous = x
+			} else {
+				previousAbsent = x
+			}
+			if rb.NextAbsentValue(uint32(x)) != nextAbsent[x] || rb.PreviousAbsentValue(uint32(x)) != previousAbsent {
+				t.Fatalf("Bad absent values around %d", x)
+			}
+			if rb.PreviousValue(uint32(x)) != previous {
+				t.Fatalf("Bad PreviousValue(%d) %d, expected %d", x, rb.PreviousValue(uint32(x)), previous)
+			}
+		}
+		for x := limit - 1; x >= 0; x-- {
+			if rb.Contains(uint32(x)) {
+				next = x
+			}
+			if rb.NextValue(uint32(x)) != next {
+				t.Fatalf("Bad NextValue(%d) %d, expected %d", x, rb.NextValue(uint32(x)), next)
+			}
+		}
+	}
+
+	full := NewRoaringBitmap()
+	full.Flip(0, 4294967295)
+	full.Add(4294967295)
+	if full.NextAbsentValue(5) != -1 || full.PreviousAbsentValue(4294967295) != -1 {
+		t.Errorf("A full bitmap has no absent value")
+	}
+	full.Remove(1 << 20)
+	if full.NextAbsentValue(5) != 1<<20 || full.PreviousAbsentValue(4294967295) != 1<<20 {
+		t.Errorf("Bad absent value in an almost full bitmap")
+	}
+	rb = BitmapOf(4294967295)
+	if rb.NextValue(0) != 4294967295 || rb.PreviousValue(4294967294) != -1 || rb.NextAbsentValue(4294967295) != -1 {
+		t.Errorf("Bad values at the top")
+	}
+}
+
+func TestRangeQueries(t *testing.T) {
+	r := rand.New(rand.NewSource(18))
+	rb := NewRoaringBitmap()
+	for i := 0; i < 2000; i++ {
+		rb.AddInt(r.Intn(1 << 18))
+	}
+	rb.AddRange(1<<18, 3<<17)
+	rb.AddRange(3<<17+10, 3<<17+1000)
+	for i := 0; i < 30000; i++ {
+		rb.AddInt(1<<19 + r.Intn(1<<16))
+	}
+	rb.AddRange(1<<20, 1<<20+3<<16)
+	rb.Add(4294967295)
+	for _, optimize := range []bool{false, true} {
+		if optimize {
+			rb.RunOptimize()
+		}
+		check := func(start, end uint64) {
+			card := uint64(0)
+			for x := start; x < end; x++ {
+				if rb.Contains(uint32(x)) {
+					card++
+				}
+			}
+			if rb.CardinalityInRange(start, end) != card || rb.RangeCardinality(start, end) != card {
+				t.Fatalf("Bad cardinality %d in [%d,%d), expected %d", rb.CardinalityInRange(start, end), start, end, card)
+			}
+			if rb.ContainsRange(start, end) != (card == end-start) {
+				t.Fatalf("Bad ContainsRange(%d,%d)", start, end)
+			}
+			if rb.IntersectsRange(start, end) != (card > 0) {
+				t.Fatalf("Bad IntersectsRange(%d,%d)", start, end)
+			}
+		}
+		for i := 0; i < 3000; i++ {
+			start := uint64(r.Intn(1<<20 + 4<<16))
+			check(start, start+uint64(r.Intn(1<<(uint(i)%18))))
+		}
+		for _, x := range []uint64{0, 1 << 16, 1 << 18, 3<<17 + 10, 1 << 19, 1 << 20, 1<<20 + 1<<16} {
+			for _, l := range []uint64{0, 1, 2, 63, 64, 65, 1000, 1 << 16, 1<<16 + 1, 2 << 16} {
+				check(x, x+l)
+				if x >= l {
+					check(x-l, x)
+				}
+			}
+		}
+		check(4294967295-1000, 1<<32)
+		if !rb.ContainsRange(4294967295, 1<<32) || rb.ContainsRange(4294967295, 1<<32+1) {
+			t.Errorf("Bad ContainsRange at the top")
+		}
+		if rb.CardinalityInRange(0, 1<<40) != rb.GetCardinality() || !rb.IntersectsRange(4294967295, 1<<40) {
+			t.Errorf("Bad ranges past the top")
+		}
+	}
+}
+
+func TestSliceRetain(t *testing.T) {
+	Convey("slice and retain", t, func() {
+		r := rand.New(rand.NewSource(19))
+		rb := NewRoaringBitmap()
+		for i := 0; i < 3000; i++ {
+			rb.AddInt(r.Intn(1 << 18))
+		}
+		for i := 0; i < 30000; i++ {
+			rb.AddInt(1<<19 + r.Intn(1<<16))
+		}
+		rb.AddRange(1<<20, 1<<20+3<<16)
+		rb.Add(4294967295)
+		for _, optimize := range []bool{false, true} {
+			if optimize {
+				rb.RunOptimize()
+			}
+			for i := 0; i < 100; i++ {
+				start := uint32(r.Intn(1<<20 + 4<<16))
+				end := start + uint32(r.Intn(1<<uint(i%20)))
+				expected := rb.Clone()
+				expected.RemoveRange(0, start)
+				expected.RemoveRange(end, 4294967295)
+				expected.Remove(4294967295)
+				So(rb.Slice(start, end).Equals(expected), ShouldBeTrue)
+				retained := rb.Clone()
+				retained.Retain(start, end)
+				So(retained.Equals(expected), ShouldBeTrue)
+			}
+		}
+		So(rb.Slice(5, 5).IsEmpty(), ShouldBeTrue)
+		So(rb.Slice(4294967294, 4294967295).IsEmpty(), ShouldBeTrue)
+		top := rb.Clone()
+		top.Retain(1<<20+1<<16, 4294967295)
+		So(top.GetCardinality(), ShouldEqual, 2<<16)
+		top.Retain(7, 7)
+		So(top.IsEmpty(), ShouldBeTrue)
+	})
+	Convey("slices share containers until written", t, func() {
+		rb := NewRoaringBitmap()
+		rb.AddRange(0, 5<<16)
+		rb.Add(6 << 16)
+		s := rb.Slice(1, 6<<16+1)
+		So(s.GetCardinality(), ShouldEqual, 5<<16)
+		So(s.highlowcontainer.getContainerAtIndex(1), ShouldEqual, rb.highlowcontainer.getContainerAtIndex(1))
+		s.Remove(1 << 16)
+		rb.Remove(2 << 16)
+		So(rb.Contains(1<<16), ShouldBeTrue)
+		So(s.Contains(2<<16), ShouldBeTrue)
+		So(rb.GetCardinality(), ShouldEqual, 5<<16)
+		So(s.GetCardinality(), ShouldEqual, 5<<16-1)
+		rb.Flip(3<<16, 4<<16)
+		So(s.Contains(3<<16+5), ShouldBeTrue)
+		So(rb.Contains(3<<16+5), ShouldBeFalse)
+	})
+}
+
+func TestRange64(t *testing.T) {
+	Convey("ranges up to the top of the key space", t, func() {
+		rb := NewRoaringBitmap()
+		rb.AddRange64(4294967290, 1<<32)
+		So(rb.GetCardinality(), ShouldEqual, 6)
+		So(rb.Contains(4294967295), ShouldBeTrue)
+		rb.AddRange64(4294967200, 1<<40)
+		So(rb.GetCardinality(), ShouldEqual, 96)
+		rb.RemoveRange64(4294967295, 1<<32)
+		So(rb.Contains(4294967295), ShouldBeFalse)
+		So(rb.GetCardinality(), ShouldEqual, 95)
+		rb.Flip64(4294967294, 1<<32)
+		So(rb.Contains(4294967294), ShouldBeFalse)
+		So(rb.Contains(4294967295), ShouldBeTrue)
+		rb.RemoveRange64(0, 1<<33)
+		So(rb.IsEmpty(), ShouldBeTrue)
+		rb.Flip64(1<<32-3<<16-5, 1<<32)
+		So(rb.GetCardinality(), ShouldEqual, 3<<16+5)
+		So(rb.Contains(4294967295), ShouldBeTrue)
+		So(rb.Contains(1<<32-3<<16-6), ShouldBeFalse)
+	})
+	Convey("complement", t, func() {
+		rb := NewRoaringBitmap()
+		rb.Complement()
+		So(rb.GetCardinality(), ShouldEqual, uint64(1)<<32)
+		So(rb.highlowcontainer.size(), ShouldEqual, 1<<16)
+		So(rb.GetSizeInBytes(), ShouldBeLessThan, 1<<22)
+		rb.Complement()
+		So(rb.IsEmpty(), ShouldBeTrue)
+
+		r := rand.New(rand.NewSource(20))
+		for i := 0; i < 3000; i++ {
+			rb.AddInt(r.Intn(1 << 18))
+		}
+		rb.AddRange(1<<19, 1<<19+3<<16)
+		rb.Add(4294967295)
+		rb.Add(0)
+		original := rb.Clone()
+		rb.Complement()
+		So(rb.GetCardinality(), ShouldEqual, uint64(1)<<32-original.GetCardinality())
+		So(rb.Intersects(original), ShouldBeFalse)
+		So(rb.Contains(0), ShouldBeFalse)
+		So(rb.Contains(4294967295), ShouldBeFalse)
+		So(rb.Contains(4294967294), ShouldBeTrue)
+		for i := 0; i < 1000; i++ {
+			x := uint32(r.Intn(1 << 20))
+			So(rb.Contains(x), ShouldNotEqual, original.Contains(x))
+		}
+		rb.Complement()
+		So(rb.Equals(original), ShouldBeTrue)
+	})
+	Convey("ranges over shared containers", t, func() {
+		rb := NewRoaringBitmap()
+		for i := 0; i < 20; i += 2 {
+			rb.AddRange(uint32(i)<<16+5, uint32(i)<<16+100)
+		}
+		clone := rb.Clone()
+		rb.AddRange64(0, 20<<16)
+		So(rb.GetCardinality(), ShouldEqual, 20<<16)
+		So(clone.GetCardinality(), ShouldEqual, 10*95)
+		clone.Flip64(3, 20<<16)
+		So(clone.GetCardinality(), ShouldEqual, 20<<16-3-10*95)
+		So(rb.GetCardinality(), ShouldEqual, 20<<16)
+	})
+}
+
+func TestAddRemoveMany(t *testing.T) {
+	Convey("add and remove many", t, func() {
+		r := rand.New(rand.NewSource(21))
+		for iter := 0; iter < 20; iter++ {
+			rb := NewRoaringBitmap()
+			rb.AddRange(1<<16, 2<<16)
+			rb.AddRange(3<<16+5, 3<<16+50)
+			for i := 0; i < 10000; i++ {
+				rb.AddInt(4<<16 + r.Intn(1<<16))
+			}
+			if iter%2 == 1 {
+				rb.RunOptimize()
+			}
+			clone := rb.Clone()
+			expected := rb.Clone()
+			var dat []uint32
+			for i := 0; i < r.Intn(20000); i++ {
+				x := uint32(r.Intn(8 << 16))
+				if iter%4 < 2 {
+					x = uint32(i*(1+iter)) % (8 << 16)
+				}
+				dat = append(dat, x)
+				if r.Intn(10) == 0 {
+					dat = append(dat, x)
+				}
+			}
+			original := append([]uint32(nil), dat...)
+			for _, x := range dat {
+				expected.Add(x)
+			}
+			rb.AddMany(dat)
+			So(rb.Equals(expected), ShouldBeTrue)
+			So(dat, ShouldResemble, original)
+			So(clone.Equals(BitmapOf(clone.ToArray()...)), ShouldBeTrue)
+
+			removed := dat[:len(dat)/2]
+			for _, x := range removed {
+				expected.Remove(x)
+			}
+			rb.RemoveMany(removed)
+			So(rb.Equals(expected), ShouldBeTrue)
+			rb.RemoveMany(rb.ToArray())
+			So(rb.IsEmpty(), ShouldBeTrue)
+			So(clone.GetCardinality(), ShouldBeGreaterThan, 1<<16)
+		}
+	})
+	Convey("add many at the edges", t, func() {
+		rb := NewRoaringBitmap()
+		rb.AddMany(nil)
+		rb.RemoveMany(nil)
+		So(rb.IsEmpty(), ShouldBeTrue)
+		rb.AddMany([]uint32{4294967295, 0, 4294967295, 65536, 0})
+		So(rb.ToArray(), ShouldResemble, []uint32{0, 65536, 4294967295})
+		So(BitmapOf(5, 3, 5, 1).ToArray(), ShouldResemble, []uint32{1, 3, 5})
+		dense := make([]uint32, 5000)
+		for i := range dense {
+			dense[i] = uint32(i % 3000)
+		}
+		rb.AddMany(dense)
+		So(rb.GetCardinality(), ShouldEqual, 3002)
+		rb.RemoveMany([]uint32{4294967295, 4294967295, 7})
+		So(rb.GetCardinality(), ShouldEqual, 3000)
+	})
+	Convey("radix sort", t, func() {
+		r := rand.New(rand.NewSource(21))
+		for _, mask := range []uint32{0xFFFFFFFF, 0xFFFF, 0xFF00FF, 0xFF} {
+			dat := make([]uint32, 1000)
+			for i := range dat {
+				dat[i] = r.Uint32() & mask
+			}
+			sorted := radixSort(append([]uint32(nil), dat...), make([]uint32, len(dat)))
+			expected := NewRoaringBitmap()
+			for _, x := range dat {
+				expected.Add(x)
+			}
+			So(isSorted(sorted), ShouldBeTrue)
+			So(len(sorted), ShouldEqual, len(dat))
+			So(BitmapOf(sorted...).Equals(expected), ShouldBeTrue)
+		}
+		So(radixSort(nil, nil), ShouldBeEmpty)
+	})
+}
+
+func TestCardinalityMetrics(t *testing.T) {
+	Convey("cardinality of operations", t, func() {
+		r := rand.New(rand.NewSource(23))
+		makeBitmap := func() *RoaringBitmap {
+			rb := NewRoaringBitmap()
+			for i := 0; i < 3000; i++ {
+				rb.AddInt(r.Intn(1 << 18))
+			}
+			for i := 0; i < 20000; i++ {
+				rb.AddInt(1<<18 + r.Intn(1<<17))
+			}
+			start := uint32(r.Intn(1 << 19))
+			rb.AddRange(start, start+uint32(r.Intn(1<<18)))
+			if r.Intn(2) == 0 {
+				rb.RunOptimize()
+			}
+			return rb
+		}
+		for i := 0; i < 30; i++ {
+			rb1, rb2 := makeBitmap(), makeBitmap()
+			and := And(rb1, rb2).GetCardinality()
+			or := Or(rb1, rb2).GetCardinality()
+			So(rb1.AndCardinality(rb2), ShouldEqual, and)
+			So(rb2.AndCardinality(rb1), ShouldEqual, and)
+			So(rb1.OrCardinality(rb2), ShouldEqual, or)
+			So(rb1.XorCardinality(rb2), ShouldEqual, Xor(rb1, rb2).GetCardinality())
+			So(rb1.AndNotCardinality(rb2), ShouldEqual, AndNot(rb1, rb2).GetCardinality())
+			So(rb2.AndNotCardinality(rb1), ShouldEqual, AndNot(rb2, rb1).GetCardinality())
+			So(Jaccard(rb1, rb2), ShouldAlmostEqual, float64(and)/float64(or))
+			So(Dice(rb1, rb2), ShouldAlmostEqual, float64(2*and)/float64(rb1.GetCardinality()+rb2.GetCardinality()))
+		}
+		rb := makeBitmap()
+		So(Jaccard(rb, rb), ShouldEqual, 1)
+		So(Dice(rb, rb), ShouldEqual, 1)
+		So(Jaccard(rb, NewRoaringBitmap()), ShouldEqual, 0)
+		So(Jaccard(NewRoaringBitmap(), NewRoaringBitmap()), ShouldEqual, 1)
+		So(Dice(NewRoaringBitmap(), NewRoaringBitmap()), ShouldEqual, 1)
+		So(BitmapOf(1, 2, 3).XorCardinality(BitmapOf(3, 4)), ShouldEqual, 3)
+	})
+	Convey("cardinality of operations does not allocate", t, func() {
+		r := rand.New(rand.NewSource(24))
+		rb1, rb2 := NewRoaringBitmap(), NewRoaringBitmap()
+		for i := 0; i < 50000; i++ {
+			rb1.AddInt(r.Intn(1 << 20))
+			rb2.AddInt(r.Intn(1 << 20))
+		}
+		rb1.AddRange(1<<20, 1<<20+100000)
+		rb2.AddRange(1<<20+5000, 1<<21)
+		rb1.RunOptimize()
+		allocs := testing.AllocsPerRun(10, func() {
+			rb1.XorCardinality(rb2)
+			rb1.AndNotCardinality(rb2)
+			rb1.OrCardinality(rb2)
+			Jaccard(rb1, rb2)
+			Dice(rb1, rb2)
+		})
+		So(allocs, ShouldEqual, 0)
+	})
+}
+
+func TestIsSubset(t *testing.T) {
+	Convey("subsets and supersets", t, func() {
+		r := rand.New(rand.NewSource(25))
+		makeBitmap := func() *RoaringBitmap {
+			rb := NewRoaringBitmap()
+			for i := 0; i < 3000; i++ {
+				rb.AddInt(r.Intn(1 << 18))
+			}
+			for i := 0; i < 20000; i++ {
+				rb.AddInt(1<<18 + r.Intn(1<<17))
+			}
+			start := uint32(r.Intn(1 << 19))
+			rb.AddRange(start, start+uint32(r.Intn(1<<18)))
+			return rb
+		}
+		for i := 0; i < 40; i++ {
+			big := makeBitmap()
+			small := big.Clone()
+			for _, x := range big.ToArray() {
+				if r.Intn(1+i%4) != 0 {
+					small.Remove(x)
+				}
+			}
+			if i%2 == 0 {
+				big.RunOptimize()
+			}
+			if i%3 == 0 {
+				small.RunOptimize()
+			}
+			So(small.IsSubset(big), ShouldBeTrue)
+			So(big.IsSuperset(small), ShouldBeTrue)
+			So(small.IsSubset(small), ShouldBeTrue)
+			So(big.IsSubset(small), ShouldEqual, small.GetCardinality() == big.GetCardinality())
+
+			other := makeBitmap()
+			So(other.IsSubset(big), ShouldEqual, other.AndCardinality(big) == other.GetCardinality())
+
+			for j := 0; j < 5; j++ {
+				v := uint32(r.Intn(1 << 20))
+				for big.Contains(v) {
+					v++
+				}
+				small.Add(v)
+				So(small.IsSubset(big), ShouldBeFalse)
+				So(big.IsSuperset(small), ShouldBeFalse)
+				small.Remove(v)
+			}
+		}
+		So(NewRoaringBitmap().IsSubset(NewRoaringBitmap()), ShouldBeTrue)
+		So(NewRoaringBitmap().IsSubset(BitmapOf(1)), ShouldBeTrue)
+		So(BitmapOf(1).IsSubset(NewRoaringBitmap()), ShouldBeFalse)
+		So(BitmapOf(1, 1<<20).IsSubset(BitmapOf(1, 2, 1<<20+1)), ShouldBeFalse)
+		So(BitmapOf(1, 1<<20).IsSubset(BitmapOf(0, 1, 2, 1<<19, 1<<20)), ShouldBeTrue)
+	})
+}
@@ -1,10 +1,23 @@
 package roaring
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 )
 
+var (
+	// ErrInvalidCookie is returned when deserializing data that does not
+	// start with a known Roaring cookie
+	ErrInvalidCookie = errors.New("roaring: invalid cookie")
+	// ErrTruncated is returned when the serialized data ends prematurely
+	ErrTruncated = errors.New("roaring: truncated input")
+	// ErrCorrupt is returned when the serialized data is inconsistent
+	ErrCorrupt = errors.New("roaring: corrupt input")
+)
+
 type container interface {
 	clone() container
 	and(container) container
@@ -20,13 +33,30 @@ type container interface {
 	not(start, final int) container               // range is [firstOfRange,lastOfRange]
 	inot(firstOfRange, lastOfRange int) container // i stands for inplace, range is [firstOfRange,lastOfRange]
 	xor(r container) container
-	getShortIterator() shortIterable
+	getShortIterator() shortPeekable
+	getReverseIterator() shortIterable
+	nextMany(hs uint32, buf []uint32, cursor int) (int, int) // fills buf from cursor, starting at 0, and returns the next cursor
+	iterate(hs uint32, f func(uint32) bool) bool             // calls f on each value, returns false if f did
+	nextRun(from int) (int, int)                             // first maximal run [start,last] of values >= from, start is -1 if none
+	minimum() uint16
+	maximum() uint16
+	nextValue(x uint16) int           // smallest value >= x, or -1
+	previousValue(x uint16) int       // largest value <= x, or -1
+	nextAbsentValue(x uint16) int     // smallest missing value >= x, or maxCapacity
+	previousAbsentValue(x uint16) int // largest missing value <= x, or -1
+	cardinalityInRange(start, end int) int
+	containsRange(start, end int) bool // whether all of [start,end) is present, with start < end
+	intersectsRange(start, end int) bool
 	contains(i uint16) bool
 	equals(i interface{}) bool
 	fillLeastSignificant16bits(array []uint32, i int, mask uint32)
 	or(r container) container
 	ior(r container) container   // i stands for inplace
 	intersects(r container) bool // whether the two containers intersect
+	andCardinality(r container) int
+	xorCardinality(r container) int
+	andNotCardinality(r container) int
+	isSubset(r container) bool // whether all the values of the container are in r
 	lazyIOR(r container) container
 	getSizeInBytes() int
 	removeRange(start, final int) container  // range is [firstOfRange,lastOfRange)
@@ -35,6 +65,8 @@ type container interface {
 	serializedSizeInBytes() int
 	readFrom(io.Reader) (int, error)
 	writeTo(io.Writer) (int, error)
+	numberOfRuns() int
+	toEfficientContainer() container
 }
 
 // careful: range is [firstOfRange,lastOfRange]
@@ -115,6 +147,61 @@ func (ra *roaringArray) removeIndexRange(begin, end int) {
 	ra.resize(len(ra.keys) - r)
 }
 
+// updateRange calls f on the containers of all the keys in [hbStart,hbLast],
+// which are writable or nil for missing keys, and stores what it returns,
+// dropping empty containers. The missing keys are inserted with a single
+// move of the following containers.
+func (ra *roaringArray) updateRange(hbStart, hbLast int, f func(key uint16, c container) container) {
+	first := ra.getIndex(uint16(hbStart))
+	if first < 0 {
+		first = -first - 1
+	}
+	last := ra.getIndex(uint16(hbLast))
+	if last < 0 {
+		last = -last - 1
+	} else {
+		last++
+	}
+	missing := hbLast - hbStart + 1 - (last - first)
+	if missing > 0 {
+		size := len(ra.keys)
+		ra.keys = append(ra.keys, make([]uint16, missing)...)
+		ra.containers = append(ra.containers, make([]container, missing)...)
+		copy(ra.keys[last+missing:], ra.keys[last:size])
+		copy(ra.containers[last+missing:], ra.containers[last:size])
+		if ra.hasDirty() {
+			ra.dirty = append(ra.dirty, make([]bool, missing)...)
+			copy(ra.dirty[last+missing:], ra.dirty[last:size])
+		}
+	}
+	// going backwards, the existing containers are read before being overwritten
+	j := last - 1
+	w := last + missing - 1
+	for key := hbLast; key >= hbStart; key-- {
+		var c container
+		if j >= first && int(ra.keys[j]) == key {
+			c = ra.getWritableContainerAtIndex(j)
+			j--
+		}
+		ra.keys[w] = uint16(key)
+		ra.containers[w] = f(uint16(key), c)
+		if ra.hasDirty() {
+			ra.dirty[w] = false
+		}
+		w--
+	}
+	end := last + missing
+	n := first
+	for i := first; i < end; i++ {
+		if ra.containers[i].getCardinality() > 0 {
+			ra.keys[n] = ra.keys[i]
+			ra.containers[n] = ra.containers[i]
+			n++
+		}
+	}
+	ra.removeIndexRange(n, end)
+}
+
 func (ra *roaringArray) resize(newsize int) {
 	for k := newsize; k < len(ra.containers); k++ {
 		ra.containers[k] = nil
@@ -289,33 +376,65 @@ func (ra *roaringArray) equals(o interface{}) bool {
 	return false
 }
 
+// headerSize returns the number of bytes written before the first container
+func (ra *roaringArray) headerSize() uint64 {
+	size := uint64(len(ra.keys))
+	if ra.hasRunCompression() {
+		if size < no_offset_threshold { // for small bitmaps, we omit the offsets
+			return 4 + (size+7)/8 + 4*size
+		}
+		return 4 + (size+7)/8 + 8*size
+	}
+	return 4 + 4 + 8*size
+}
+
 func (ra *roaringArray) serializedSizeInBytes() uint64 {
-	count := uint64(4 + 4)
+	count := ra.headerSize()
 	for _, c := range ra.containers {
-		count = count + 4 + 4
 		count = count + uint64(c.serializedSizeInBytes())
 	}
 	return count
 }
 
+// writeTo writes the portable format shared with the Java and C
+// implementations, see https://github.com/RoaringBitmap/RoaringFormatSpec
 func (ra *roaringArray) writeTo(stream io.Writer) (int, error) {
-	preambleSize := 4 + 4 + 4*len(ra.keys)
-	buf := make([]byte, preambleSize+4*len(ra.keys))
-	binary.LittleEndian.PutUint32(buf[0:], uint32(serial_cookie))
-	binary.LittleEndian.PutUint32(buf[4:], uint32(len(ra.keys)))
+	hasRun := ra.hasRunCompression()
+	preambleSize := int(ra.headerSize())
+	buf := make([]byte, preambleSize)
+	pos := 0
+	if hasRun {
+		binary.LittleEndian.PutUint32(buf[0:], uint32(serial_cookie_run|((len(ra.keys)-1)<<16)))
+		pos += 4
+		// one bit per container, set for run containers
+		for i, c := range ra.containers {
+			if _, ok := c.(*runContainer); ok {
+				buf[pos+i/8] |= 1 << (uint(i) % 8)
+			}
+		}
+		pos += (len(ra.keys) + 7) / 8
+	} else {
+		binary.LittleEndian.PutUint32(buf[0:], uint32(serial_cookie))
+		binary.LittleEndian.PutUint32(buf[4:], uint32(len(ra.keys)))
+		pos += 8
+	}
 
 	for i, key := range ra.keys {
-		off := 8 + i*4
-		binary.LittleEndian.PutUint16(buf[off:], uint16(key))
-
-		c := ra.containers[i]
-		binary.LittleEndian.PutUint16(buf[off+2:], uint16(c.getCardinality()-1))
+		binary.LittleEndian.PutUint16(buf[pos:], uint16(key))
+		binary.LittleEndian.PutUint16(buf[pos+2:], uint16(ra.containers[i].getCardinality()-1))
+		pos += 4
 	}
 
-	startOffset := preambleSize + 4*len(ra.keys)
-	for i, c := range ra.containers {
-		binary.LittleEndian.PutUint32(buf[preambleSize+i*4:], uint32(startOffset))
-		startOffset += getSizeInBytesFromCardinality(c.getCardinality())
+	startOffset := preambleSize
+	if !hasRun || len(ra.keys) >= no_offset_threshold {
+		for i, c := range ra.containers {
+			binary.LittleEndian.PutUint32(buf[pos+i*4:], uint32(startOffset))
+			startOffset += c.serializedSizeInBytes()
+		}
+	} else {
+		for _, c := range ra.containers {
+			startOffset += c.serializedSizeInBytes()
+		}
 	}
 
 	_, err := stream.Write(buf)
@@ -332,48 +451,244 @@ func (ra *roaringArray) writeTo(stream io.Writer) (int, error) {
 	return startOffset, nil
 }
 
-func (ra *roaringArray) readFrom(stream io.Reader) (int, error) {
+// serialHeader is the descriptive header preceding the serialized containers
+type serialHeader struct {
+	keycard []uint16 // key and cardinality minus one of each container
+	isRun   []byte   // bitset marking the run containers, nil without runs
+	offsets []uint32 // start of each container, nil when omitted
+}
+
+func (h *serialHeader) size() int {
+	return len(h.keycard) / 2
+}
+
+func (h *serialHeader) key(i int) uint16 {
+	return h.keycard[2*i]
+}
+
+func (h *serialHeader) cardinality(i int) int {
+	return int(h.keycard[2*i+1]) + 1
+}
+
+func (h *serialHeader) isRunContainer(i int) bool {
+	return h.isRun != nil && h.isRun[i/8]&(1<<(uint(i)%8)) != 0
+}
+
+// checkOffset verifies that container i starts at offset, when the
+// header records offsets
+func (h *serialHeader) checkOffset(i, offset int) error {
+	if h.offsets != nil && int(h.offsets[i]) != offset {
+		return fmt.Errorf("%w: container %d is at offset %d, not %d", ErrCorrupt, i, offset, h.offsets[i])
+	}
+	return nil
+}
+
+// validateContainer checks container i once it has been deserialized,
+// card being the cardinality recorded in the header
+func validateContainer(i int, c container, card int) error {
+	var err error
+	switch c.(type) {
+	case *arrayContainer:
+		err = c.(*arrayContainer).validate()
+	case *bitmapContainer:
+		err = c.(*bitmapContainer).validate()
+	case *runContainer:
+		err = c.(*runContainer).validate()
+	}
+	if err != nil {
+		return fmt.Errorf("container %d: %w", i, err)
+	}
+	if c.getCardinality() != card {
+		return fmt.Errorf("%w: container %d has cardinality %d, not %d", ErrCorrupt, i, c.getCardinality(), card)
+	}
+	return nil
+}
+
+func readSerialHeader(stream io.Reader) (*serialHeader, int, error) {
+	h := &serialHeader{}
+	offset := 0
 	var cookie uint32
 	err := binary.Read(stream, binary.LittleEndian, &cookie)
 	if err != nil {
-		return 0, err
-	}
-	if cookie != serial_cookie {
-		return 0, err
+		return nil, offset, truncated(err)
 	}
+	offset += 4
 	var size uint32
-	err = binary.Read(stream, binary.LittleEndian, &size)
-	if err != nil {
-		return 0, err
+	if cookie&0x0000FFFF == serial_cookie_run {
+		size = cookie>>16 + 1
+		h.isRun = make([]byte, (size+7)/8)
+		_, err = io.ReadFull(stream, h.isRun)
+		if err != nil {
+			return nil, offset, truncated(err)
+		}
+		offset += len(h.isRun)
+	} else if cookie == serial_cookie {
+		err = binary.Read(stream, binary.LittleEndian, &size)
+		if err != nil {
+			return nil, offset, truncated(err)
+		}
+		offset += 4
+		if size > maxCapacity {
+			return nil, offset, fmt.Errorf("%w: %d containers", ErrCorrupt, size)
+		}
+	} else {
+		return nil, offset, fmt.Errorf("%w: %d", ErrInvalidCookie, cookie)
 	}
-	keycard := make([]uint16, 2*size, 2*size)
-	err = binary.Read(stream, binary.LittleEndian, keycard)
+	h.keycard = make([]uint16, 2*size, 2*size)
+	err = binary.Read(stream, binary.LittleEndian, h.keycard)
 	if err != nil {
-		return 0, err
+		return nil, offset, truncated(err)
+	}
+	offset += int(4 * size)
+	for i := 1; i < int(size); i++ {
+		if h.key(i) <= h.key(i-1) {
+			return nil, offset, fmt.Errorf("%w: keys are not strictly increasing at container %d", ErrCorrupt, i)
+		}
+	}
+	if h.isRun == nil || size >= no_offset_threshold {
+		h.offsets = make([]uint32, size, size)
+		err = binary.Read(stream, binary.LittleEndian, h.offsets)
+		if err != nil {
+			return nil, offset, truncated(err)
+		}
+		offset += int(4 * size)
 	}
-	offsets := make([]uint32, size, size)
-	err = binary.Read(stream, binary.LittleEndian, offsets)
+	return h, offset, nil
+}
+
+// readFrom replaces the content of ra with the serialized bitmap read from
+// stream. Malformed input is rejected with ErrInvalidCookie, ErrTruncated
+// or ErrCorrupt, leaving ra empty.
+func (ra *roaringArray) readFrom(stream io.Reader) (offset int, err error) {
+	ra.clear()
+	defer func() {
+		if err != nil {
+			ra.clear()
+		}
+	}()
+
+	h, offset, err := readSerialHeader(stream)
 	if err != nil {
-		return 0, err
+		return offset, err
 	}
-	offset := int(4 + 4 + 8*size)
-	for i := uint32(0); i < size; i++ {
-		c := int(keycard[2*i+1]) + 1
-		offset += int(getSizeInBytesFromCardinality(c))
-		if c > arrayDefaultMaxSize {
+	for i := 0; i < h.size(); i++ {
+		if err = h.checkOffset(i, offset); err != nil {
+			return offset, err
+		}
+		card := h.cardinality(i)
+		var c container
+		var n int
+		if h.isRunContainer(i) {
+			nb := newRunContainer()
+			n, err = nb.readFrom(stream)
+			c = nb
+		} else if card > arrayDefaultMaxSize {
 			nb := newBitmapContainer()
-			nb.readFrom(stream)
-			nb.cardinality = int(c)
-			ra.appendContainer(keycard[2*i], nb)
+			n, err = nb.readFrom(stream)
+			nb.cardinality = card
+			c = nb
 		} else {
-			nb := newArrayContainerSize(int(c))
-			nb.readFrom(stream)
-			ra.appendContainer(keycard[2*i], nb)
+			nb := newArrayContainerSize(card)
+			n, err = nb.readFrom(stream)
+			c = nb
 		}
+		offset += n
+		if err != nil {
+			return offset, fmt.Errorf("container %d: %w", i, truncated(err))
+		}
+		if err = validateContainer(i, c, h.cardinality(i)); err != nil {
+			return offset, err
+		}
+		ra.appendContainer(h.key(i), c)
 	}
 	return offset, nil
 }
 
+// fromBuffer replaces the content of ra with the serialized bitmap in buf.
+// Where the platform allows it, the containers alias buf rather than copy
+// it; they are all marked dirty so that they get cloned before any change.
+func (ra *roaringArray) fromBuffer(buf []byte) (offset int, err error) {
+	ra.clear()
+	defer func() {
+		if err != nil {
+			ra.clear()
+		}
+	}()
+
+	h, offset, err := readSerialHeader(bytes.NewReader(buf))
+	if err != nil {
+		return offset, err
+	}
+	for i := 0; i < h.size(); i++ {
+		if err = h.checkOffset(i, offset); err != nil {
+			return offset, err
+		}
+		var c container
+		c, offset, err = containerFromBuffer(buf, offset, h.cardinality(i), h.isRunContainer(i))
+		if err != nil {
+			return offset, fmt.Errorf("container %d: %w", i, err)
+		}
+		if err = validateContainer(i, c, h.cardinality(i)); err != nil {
+			return offset, err
+		}
+		ra.appendContainer(h.key(i), c)
+	}
+	ra.markAllDirty()
+	return offset, nil
+}
+
+// containerFromBuffer returns the container serialized at offset in buf,
+// aliasing buf where the platform allows it, and the offset following it.
+// Adjacent runs are merged into a private copy so run containers stay maximal.
+func containerFromBuffer(buf []byte, offset, card int, isRun bool) (container, int, error) {
+	if isRun {
+		if len(buf) < offset+2 {
+			return nil, offset, ErrTruncated
+		}
+		nr := int(binary.LittleEndian.Uint16(buf[offset:]))
+		offset += 2
+		if len(buf) < offset+4*nr {
+			return nil, offset, ErrTruncated
+		}
+		c := &runContainer{byteSliceAsInterval16Slice(buf[offset : offset+4*nr : offset+4*nr])}
+		c.mergeAdjacent()
+		return c, offset + 4*nr, nil
+	}
+	size := getSizeInBytesFromCardinality(card)
+	if len(buf) < offset+size {
+		return nil, offset, ErrTruncated
+	}
+	data := buf[offset : offset+size : offset+size]
+	if card > arrayDefaultMaxSize {
+		return &bitmapContainer{card, byteSliceAsUint64Slice(data)}, offset + size, nil
+	}
+	return &arrayContainer{byteSliceAsUint16Slice(data)}, offset + size, nil
+}
+
+// truncated reports the errors returned by io.ReadFull and binary.Read on
+// short input as ErrTruncated
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
+
+func (ra *roaringArray) runOptimize() {
+	for i, c := range ra.containers {
+		ra.containers[i] = c.toEfficientContainer()
+	}
+}
+
+func (ra *roaringArray) hasRunCompression() bool {
+	for _, c := range ra.containers {
+		if _, ok := c.(*runContainer); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (ra *roaringArray) advanceUntil(min uint16, pos int) int {
 	lower := pos + 1
 
@@ -432,6 +747,21 @@ func (ra *roaringArray) markAllDirty() {
 	ra.dirty = dirty
 }
 
+func (ra *roaringArray) markDirty(i int) {
+	if !ra.hasDirty() {
+		ra.dirty = make([]bool, len(ra.keys))
+	}
+	ra.dirty[i] = true
+}
+
+// appendShared appends the container at index i of sa without copying it,
+// both bitmaps then clone it before any change
+func (ra *roaringArray) appendShared(sa *roaringArray, i int) {
+	sa.markDirty(i)
+	ra.appendContainer(sa.keys[i], sa.containers[i])
+	ra.markDirty(len(ra.keys) - 1)
+}
+
 func (ra *roaringArray) hasDirty() bool {
 	return len(ra.dirty) > 0
 }
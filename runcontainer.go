@@ -0,0 +1,958 @@
+package roaring
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// interval16 is the run of consecutive values [start, start+length]. The
+// length is stored minus one, as in the serialized format, so that a full
+// container fits in a single interval.
+type interval16 struct {
+	start  uint16
+	length uint16
+}
+
+func newInterval16Range(start, last int) interval16 {
+	return interval16{uint16(start), uint16(last - start)}
+}
+
+func (iv interval16) last() int {
+	return int(iv.start) + int(iv.length)
+}
+
+// runContainer stores a set of 16-bit values as sorted, non-overlapping and
+// non-adjacent intervals.
+type runContainer struct {
+	iv []interval16
+}
+
+func newRunContainer() *runContainer {
+	return &runContainer{make([]interval16, 0)}
+}
+
+func newRunContainerCapacity(size int) *runContainer {
+	return &runContainer{make([]interval16, 0, size)}
+}
+
+// careful: range is [firstOfRun,lastOfRun]
+func newRunContainerRange(firstOfRun, lastOfRun int) *runContainer {
+	return &runContainer{[]interval16{newInterval16Range(firstOfRun, lastOfRun)}}
+}
+
+func newRunContainerFromArray(ac *arrayContainer) *runContainer {
+	rc := newRunContainer()
+	for _, v := range ac.content {
+		rc.iv = appendInterval(rc.iv, interval16{v, 0})
+	}
+	return rc
+}
+
+func newRunContainerFromBitmap(bc *bitmapContainer) *runContainer {
+	rc := newRunContainer()
+	i := bc.NextSetBit(0)
+	for i >= 0 {
+		j := bc.nextClearBit(i)
+		rc.iv = append(rc.iv, newInterval16Range(i, j-1))
+		i = bc.NextSetBit(j)
+	}
+	return rc
+}
+
+// appendInterval adds iv at the end of ivs, merging it with the last interval
+// when the two overlap or touch; iv must not start before the last interval.
+func appendInterval(ivs []interval16, iv interval16) []interval16 {
+	n := len(ivs)
+	if n > 0 && int(iv.start) <= ivs[n-1].last()+1 {
+		if iv.last() > ivs[n-1].last() {
+			ivs[n-1].length = uint16(iv.last() - int(ivs[n-1].start))
+		}
+		return ivs
+	}
+	return append(ivs, iv)
+}
+
+func unionIntervals(a, b []interval16) []interval16 {
+	answer := make([]interval16, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if j == len(b) || (i < len(a) && a[i].start <= b[j].start) {
+			answer = appendInterval(answer, a[i])
+			i++
+		} else {
+			answer = appendInterval(answer, b[j])
+			j++
+		}
+	}
+	return answer
+}
+
+func intersectIntervals(a, b []interval16) []interval16 {
+	answer := make([]interval16, 0)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		start := a[i].start
+		if b[j].start > start {
+			start = b[j].start
+		}
+		last := a[i].last()
+		if b[j].last() < last {
+			last = b[j].last()
+		}
+		if int(start) <= last {
+			answer = append(answer, newInterval16Range(int(start), last))
+		}
+		if a[i].last() < b[j].last() {
+			i++
+		} else {
+			j++
+		}
+	}
+	return answer
+}
+
+// differenceIntervals returns the values of a that are not in b
+func differenceIntervals(a, b []interval16) []interval16 {
+	answer := make([]interval16, 0, len(a))
+	j := 0
+	for _, iv := range a {
+		start, last := int(iv.start), iv.last()
+		for j < len(b) && b[j].last() < start {
+			j++
+		}
+		for k := j; k < len(b) && int(b[k].start) <= last; k++ {
+			if int(b[k].start) > start {
+				answer = append(answer, newInterval16Range(start, int(b[k].start)-1))
+			}
+			start = b[k].last() + 1
+			if start > last {
+				break
+			}
+		}
+		if start <= last {
+			answer = append(answer, newInterval16Range(start, last))
+		}
+	}
+	return answer
+}
+
+// boundaries returns the sorted positions at which membership toggles,
+// i.e., the half-open [start, last+1) ends of every interval
+func boundaries(ivs []interval16) []int {
+	answer := make([]int, 0, 2*len(ivs))
+	for _, iv := range ivs {
+		answer = append(answer, int(iv.start), iv.last()+1)
+	}
+	return answer
+}
+
+func xorIntervals(a, b []interval16) []interval16 {
+	// the symmetric difference toggles membership at every boundary of
+	// either input, except where both inputs toggle at the same position
+	ba := boundaries(a)
+	bb := boundaries(b)
+	merged := make([]int, 0, len(ba)+len(bb))
+	i, j := 0, 0
+	for i < len(ba) || j < len(bb) {
+		if j == len(bb) || (i < len(ba) && ba[i] < bb[j]) {
+			merged = append(merged, ba[i])
+			i++
+		} else if i == len(ba) || bb[j] < ba[i] {
+			merged = append(merged, bb[j])
+			j++
+		} else {
+			i++
+			j++
+		}
+	}
+	answer := make([]interval16, 0, len(merged)/2)
+	for k := 0; k+1 < len(merged); k += 2 {
+		answer = append(answer, newInterval16Range(merged[k], merged[k+1]-1))
+	}
+	return answer
+}
+
+// search returns the index of the last interval starting at or before x,
+// or -1 if there is none
+func (rc *runContainer) search(x int) int {
+	low, high := 0, len(rc.iv)
+	for low < high {
+		middleIndex := int(uint(low+high) >> 1)
+		if int(rc.iv[middleIndex].start) <= x {
+			low = middleIndex + 1
+		} else {
+			high = middleIndex
+		}
+	}
+	return low - 1
+}
+
+// validate checks that the runs are sorted, non-overlapping and within the
+// 16-bit range. Adjacent runs are merged into a newly allocated slice.
+func (rc *runContainer) validate() error {
+	for i, iv := range rc.iv {
+		if iv.last() >= maxCapacity {
+			return fmt.Errorf("%w: run %d overflows the container", ErrCorrupt, i)
+		}
+		if i > 0 && int(iv.start) <= rc.iv[i-1].last() {
+			return fmt.Errorf("%w: run %d overlaps the previous run", ErrCorrupt, i)
+		}
+	}
+	rc.mergeAdjacent()
+	return nil
+}
+
+// mergeAdjacent replaces runs that touch each other with a newly allocated
+// slice of maximal runs, leaving the original (possibly mapped) slice alone.
+// Unsorted or overlapping runs are left for validate to report.
+func (rc *runContainer) mergeAdjacent() {
+	adjacent := false
+	for i := 1; i < len(rc.iv); i++ {
+		previous := rc.iv[i-1].last()
+		if int(rc.iv[i].start) <= previous {
+			return
+		}
+		adjacent = adjacent || int(rc.iv[i].start) == previous+1
+	}
+	if adjacent {
+		merged := make([]interval16, 0, len(rc.iv))
+		for _, iv := range rc.iv {
+			merged = appendInterval(merged, iv)
+		}
+		rc.iv = merged
+	}
+}
+
+func (rc *runContainer) numberOfRuns() int {
+	return len(rc.iv)
+}
+
+func (rc *runContainer) isFull() bool {
+	return len(rc.iv) == 1 && rc.iv[0].start == 0 && rc.iv[0].last() == maxCapacity-1
+}
+
+func (rc *runContainer) fillLeastSignificant16bits(x []uint32, i int, mask uint32) {
+	pos := i
+	for _, iv := range rc.iv {
+		for v := int(iv.start); v <= iv.last(); v++ {
+			x[pos] = uint32(v) | mask
+			pos++
+		}
+	}
+}
+
+type runContainerShortIterator struct {
+	ptr    *runContainer
+	pos    int
+	offset int
+}
+
+func (rcsi *runContainerShortIterator) next() uint16 {
+	iv := rcsi.ptr.iv[rcsi.pos]
+	x := int(iv.start) + rcsi.offset
+	rcsi.offset++
+	if rcsi.offset > int(iv.length) {
+		rcsi.pos++
+		rcsi.offset = 0
+	}
+	return uint16(x)
+}
+
+func (rcsi *runContainerShortIterator) hasNext() bool {
+	return rcsi.pos < len(rcsi.ptr.iv)
+}
+
+func (rcsi *runContainerShortIterator) peekNext() uint16 {
+	return uint16(int(rcsi.ptr.iv[rcsi.pos].start) + rcsi.offset)
+}
+
+func (rcsi *runContainerShortIterator) advanceIfNeeded(minval uint16) {
+	if !rcsi.hasNext() || rcsi.peekNext() >= minval {
+		return
+	}
+	// the run holding or preceding minval is at or after the current one
+	i := rcsi.ptr.search(int(minval))
+	if int(minval) <= rcsi.ptr.iv[i].last() {
+		rcsi.pos = i
+		rcsi.offset = int(minval) - int(rcsi.ptr.iv[i].start)
+	} else {
+		rcsi.pos = i + 1
+		rcsi.offset = 0
+	}
+}
+
+func (rc *runContainer) getShortIterator() shortPeekable {
+	return &runContainerShortIterator{rc, 0, 0}
+}
+
+type reverseRunContainerShortIterator struct {
+	ptr    *runContainer
+	pos    int
+	offset int // distance from the last value of the current run
+}
+
+func (rcsi *reverseRunContainerShortIterator) next() uint16 {
+	iv := rcsi.ptr.iv[rcsi.pos]
+	x := iv.last() - rcsi.offset
+	rcsi.offset++
+	if rcsi.offset > int(iv.length) {
+		rcsi.pos--
+		rcsi.offset = 0
+	}
+	return uint16(x)
+}
+
+func (rcsi *reverseRunContainerShortIterator) hasNext() bool {
+	return rcsi.pos >= 0
+}
+
+func (rc *runContainer) getReverseIterator() shortIterable {
+	return &reverseRunContainerShortIterator{rc, len(rc.iv) - 1, 0}
+}
+
+func (rc *runContainer) iterate(hs uint32, f func(uint32) bool) bool {
+	for _, iv := range rc.iv {
+		for v := int(iv.start); v <= iv.last(); v++ {
+			if !f(uint32(v) | hs) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (rc *runContainer) nextRun(from int) (int, int) {
+	i := rc.search(from)
+	if i < 0 || from > rc.iv[i].last() {
+		i++
+	}
+	if i == len(rc.iv) {
+		return -1, -1
+	}
+	start := int(rc.iv[i].start)
+	if start < from {
+		start = from
+	}
+	return start, rc.iv[i].last()
+}
+
+// nextMany fills buf with the values from value cursor on
+func (rc *runContainer) nextMany(hs uint32, buf []uint32, cursor int) (int, int) {
+	i := rc.search(cursor)
+	if i < 0 || cursor > rc.iv[i].last() {
+		i++
+	}
+	n := 0
+	for ; i < len(rc.iv) && n < len(buf); i++ {
+		v := int(rc.iv[i].start)
+		if v < cursor {
+			v = cursor
+		}
+		for ; v <= rc.iv[i].last() && n < len(buf); v++ {
+			buf[n] = uint32(v) | hs
+			n++
+		}
+		cursor = v
+	}
+	return n, cursor
+}
+
+func (rc *runContainer) getSizeInBytes() int {
+	return len(rc.iv)*4 + int(unsafe.Sizeof(rc.iv))
+}
+
+func (rc *runContainer) serializedSizeInBytes() int {
+	return runContainerSerializedSizeInBytes(len(rc.iv))
+}
+
+func runContainerSerializedSizeInBytes(numRuns int) int {
+	return 2 + numRuns*4
+}
+
+func (rc *runContainer) getCardinality() int {
+	card := 0
+	for _, iv := range rc.iv {
+		card += int(iv.length) + 1
+	}
+	return card
+}
+
+func (rc *runContainer) clone() container {
+	ptr := runContainer{make([]interval16, len(rc.iv))}
+	copy(ptr.iv, rc.iv)
+	return &ptr
+}
+
+func (rc *runContainer) contains(x uint16) bool {
+	i := rc.search(int(x))
+	return i >= 0 && int(x) <= rc.iv[i].last()
+}
+
+func (rc *runContainer) equals(o interface{}) bool {
+	srb, ok := o.(*runContainer)
+	if ok {
+		if len(srb.iv) != len(rc.iv) {
+			return false
+		}
+		for i, iv := range rc.iv {
+			if iv != srb.iv[i] {
+				return false
+			}
+		}
+		return true
+	}
+	c, ok := o.(container)
+	if !ok || c.getCardinality() != rc.getCardinality() {
+		return false
+	}
+	si := c.getShortIterator()
+	for _, iv := range rc.iv {
+		for v := int(iv.start); v <= iv.last(); v++ {
+			if int(si.next()) != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (rc *runContainer) minimum() uint16 {
+	return rc.iv[0].start
+}
+
+func (rc *runContainer) maximum() uint16 {
+	return uint16(rc.iv[len(rc.iv)-1].last())
+}
+
+func (rc *runContainer) nextValue(x uint16) int {
+	i := rc.search(int(x))
+	if i >= 0 && int(x) <= rc.iv[i].last() {
+		return int(x)
+	}
+	i++
+	if i == len(rc.iv) {
+		return -1
+	}
+	return int(rc.iv[i].start)
+}
+
+func (rc *runContainer) previousValue(x uint16) int {
+	i := rc.search(int(x))
+	if i < 0 {
+		return -1
+	}
+	if int(x) <= rc.iv[i].last() {
+		return int(x)
+	}
+	return rc.iv[i].last()
+}
+
+// the runs are maximal, so the values around a run are missing
+func (rc *runContainer) nextAbsentValue(x uint16) int {
+	i := rc.search(int(x))
+	if i < 0 || int(x) > rc.iv[i].last() {
+		return int(x)
+	}
+	return rc.iv[i].last() + 1
+}
+
+func (rc *runContainer) previousAbsentValue(x uint16) int {
+	i := rc.search(int(x))
+	if i < 0 || int(x) > rc.iv[i].last() {
+		return int(x)
+	}
+	return int(rc.iv[i].start) - 1
+}
+
+func (rc *runContainer) cardinalityInRange(start, end int) int {
+	i := rc.search(start)
+	if i < 0 {
+		i = 0
+	}
+	answer := 0
+	for ; i < len(rc.iv) && int(rc.iv[i].start) < end; i++ {
+		s := int(rc.iv[i].start)
+		if s < start {
+			s = start
+		}
+		e := rc.iv[i].last() + 1
+		if e > end {
+			e = end
+		}
+		if e > s {
+			answer += e - s
+		}
+	}
+	return answer
+}
+
+// the runs are maximal, so a range is contained in at most one of them
+func (rc *runContainer) containsRange(start, end int) bool {
+	i := rc.search(start)
+	return i >= 0 && end-1 <= rc.iv[i].last()
+}
+
+func (rc *runContainer) intersectsRange(start, end int) bool {
+	i := rc.search(end - 1)
+	return i >= 0 && rc.iv[i].last() >= start
+}
+
+func (rc *runContainer) rank(x uint16) int {
+	answer := 0
+	for _, iv := range rc.iv {
+		if int(x) < int(iv.start) {
+			break
+		}
+		if int(x) <= iv.last() {
+			return answer + int(x) - int(iv.start) + 1
+		}
+		answer += int(iv.length) + 1
+	}
+	return answer
+}
+
+func (rc *runContainer) selectInt(x uint16) int {
+	remaining := int(x)
+	for _, iv := range rc.iv {
+		if remaining <= int(iv.length) {
+			return int(iv.start) + remaining
+		}
+		remaining -= int(iv.length) + 1
+	}
+	return -1
+}
+
+func (rc *runContainer) add(x uint16) container {
+	i := rc.search(int(x))
+	if i >= 0 && int(x) <= rc.iv[i].last() {
+		return rc
+	}
+	joinPrevious := i >= 0 && rc.iv[i].last()+1 == int(x)
+	joinNext := i+1 < len(rc.iv) && int(rc.iv[i+1].start) == int(x)+1
+	switch {
+	case joinPrevious && joinNext:
+		rc.iv[i].length = uint16(rc.iv[i+1].last() - int(rc.iv[i].start))
+		rc.iv = append(rc.iv[:i+1], rc.iv[i+2:]...)
+	case joinPrevious:
+		rc.iv[i].length++
+	case joinNext:
+		rc.iv[i+1].start--
+		rc.iv[i+1].length++
+	default:
+		rc.iv = append(rc.iv, interval16{})
+		copy(rc.iv[i+2:], rc.iv[i+1:])
+		rc.iv[i+1] = interval16{x, 0}
+	}
+	return rc
+}
+
+func (rc *runContainer) remove(x uint16) container {
+	i := rc.search(int(x))
+	if i < 0 || int(x) > rc.iv[i].last() {
+		return rc
+	}
+	iv := rc.iv[i]
+	switch {
+	case iv.length == 0:
+		rc.iv = append(rc.iv[:i], rc.iv[i+1:]...)
+	case x == iv.start:
+		rc.iv[i].start++
+		rc.iv[i].length--
+	case int(x) == iv.last():
+		rc.iv[i].length--
+	default:
+		rc.iv = append(rc.iv, interval16{})
+		copy(rc.iv[i+2:], rc.iv[i+1:])
+		rc.iv[i] = newInterval16Range(int(iv.start), int(x)-1)
+		rc.iv[i+1] = newInterval16Range(int(x)+1, iv.last())
+	}
+	return rc
+}
+
+func (rc *runContainer) addRange(firstOfRange, lastOfRange int) container {
+	if firstOfRange >= lastOfRange {
+		return rc.clone()
+	}
+	return &runContainer{unionIntervals(rc.iv, []interval16{newInterval16Range(firstOfRange, lastOfRange-1)})}
+}
+
+func (rc *runContainer) iaddRange(firstOfRange, lastOfRange int) container {
+	if firstOfRange >= lastOfRange {
+		return rc
+	}
+	rc.iv = unionIntervals(rc.iv, []interval16{newInterval16Range(firstOfRange, lastOfRange-1)})
+	return rc
+}
+
+func (rc *runContainer) removeRange(firstOfRange, lastOfRange int) container {
+	if firstOfRange >= lastOfRange {
+		return rc.clone()
+	}
+	return &runContainer{differenceIntervals(rc.iv, []interval16{newInterval16Range(firstOfRange, lastOfRange-1)})}
+}
+
+func (rc *runContainer) iremoveRange(firstOfRange, lastOfRange int) container {
+	if firstOfRange >= lastOfRange {
+		return rc
+	}
+	rc.iv = differenceIntervals(rc.iv, []interval16{newInterval16Range(firstOfRange, lastOfRange-1)})
+	return rc
+}
+
+func (rc *runContainer) not(firstOfRange, lastOfRange int) container {
+	if firstOfRange > lastOfRange {
+		return rc.clone()
+	}
+	return &runContainer{xorIntervals(rc.iv, []interval16{newInterval16Range(firstOfRange, lastOfRange)})}
+}
+
+func (rc *runContainer) inot(firstOfRange, lastOfRange int) container {
+	if firstOfRange > lastOfRange {
+		return rc
+	}
+	rc.iv = xorIntervals(rc.iv, []interval16{newInterval16Range(firstOfRange, lastOfRange)})
+	return rc
+}
+
+func (rc *runContainer) toBitmapContainer() *bitmapContainer {
+	bc := newBitmapContainer()
+	for _, iv := range rc.iv {
+		setBitmapRange(bc.bitmap, int(iv.start), iv.last()+1)
+	}
+	bc.computeCardinality()
+	return bc
+}
+
+func (rc *runContainer) toArrayContainer() *arrayContainer {
+	ac := newArrayContainerCapacity(rc.getCardinality())
+	for _, iv := range rc.iv {
+		for v := int(iv.start); v <= iv.last(); v++ {
+			ac.content = append(ac.content, uint16(v))
+		}
+	}
+	return ac
+}
+
+func (rc *runContainer) toBitmapOrArrayContainer() container {
+	if rc.getCardinality() <= arrayDefaultMaxSize {
+		return rc.toArrayContainer()
+	}
+	return rc.toBitmapContainer()
+}
+
+// toEfficientContainer converts the container to whichever of the array,
+// bitmap or run representations serializes to the fewest bytes
+func (rc *runContainer) toEfficientContainer() container {
+	if rc.serializedSizeInBytes() <= getSizeInBytesFromCardinality(rc.getCardinality()) {
+		return rc
+	}
+	return rc.toBitmapOrArrayContainer()
+}
+
+func (rc *runContainer) or(a container) container {
+	switch a.(type) {
+	case *arrayContainer:
+		return rc.orArray(a.(*arrayContainer))
+	case *bitmapContainer:
+		return rc.orBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return rc.orRun(a.(*runContainer))
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) ior(a container) container {
+	return rc.or(a)
+}
+
+func (rc *runContainer) lazyIOR(a container) container {
+	return rc.or(a)
+}
+
+func (rc *runContainer) orArray(value2 *arrayContainer) container {
+	if rc.isFull() {
+		return rc.clone()
+	}
+	return rc.orRun(newRunContainerFromArray(value2))
+}
+
+func (rc *runContainer) orBitmap(value2 *bitmapContainer) container {
+	if rc.isFull() {
+		return rc.clone()
+	}
+	answer := value2.clone().(*bitmapContainer)
+	for _, iv := range rc.iv {
+		setBitmapRange(answer.bitmap, int(iv.start), iv.last()+1)
+	}
+	answer.computeCardinality()
+	return answer
+}
+
+func (rc *runContainer) orRun(value2 *runContainer) container {
+	answer := &runContainer{unionIntervals(rc.iv, value2.iv)}
+	return answer.toEfficientContainer()
+}
+
+func (rc *runContainer) and(a container) container {
+	switch a.(type) {
+	case *arrayContainer:
+		return rc.andArray(a.(*arrayContainer))
+	case *bitmapContainer:
+		return rc.andBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return rc.andRun(a.(*runContainer))
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) iand(a container) container {
+	return rc.and(a)
+}
+
+func (rc *runContainer) andArray(value2 *arrayContainer) container {
+	answer := newArrayContainerCapacity(value2.getCardinality())
+	i := 0
+	for _, v := range value2.content {
+		for i < len(rc.iv) && rc.iv[i].last() < int(v) {
+			i++
+		}
+		if i == len(rc.iv) {
+			break
+		}
+		if v >= rc.iv[i].start {
+			answer.content = append(answer.content, v)
+		}
+	}
+	return answer
+}
+
+func (rc *runContainer) andBitmap(value2 *bitmapContainer) container {
+	card := rc.getCardinality()
+	if card <= arrayDefaultMaxSize {
+		answer := newArrayContainerCapacity(card)
+		for _, iv := range rc.iv {
+			for v := int(iv.start); v <= iv.last(); v++ {
+				if value2.contains(uint16(v)) {
+					answer.content = append(answer.content, uint16(v))
+				}
+			}
+		}
+		return answer
+	}
+	answer := value2.clone().(*bitmapContainer)
+	return answer.iandRun(rc)
+}
+
+func (rc *runContainer) andRun(value2 *runContainer) container {
+	answer := &runContainer{intersectIntervals(rc.iv, value2.iv)}
+	return answer.toEfficientContainer()
+}
+
+func (rc *runContainer) intersects(a container) bool {
+	switch a.(type) {
+	case *arrayContainer:
+		return rc.intersectsArray(a.(*arrayContainer))
+	case *bitmapContainer:
+		return rc.intersectsBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return rc.intersectsRun(a.(*runContainer))
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) andCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer:
+		answer := 0
+		i := 0
+		for _, v := range a.(*arrayContainer).content {
+			for i < len(rc.iv) && rc.iv[i].last() < int(v) {
+				i++
+			}
+			if i == len(rc.iv) {
+				break
+			}
+			if v >= rc.iv[i].start {
+				answer++
+			}
+		}
+		return answer
+	case *bitmapContainer:
+		answer := 0
+		for _, iv := range rc.iv {
+			answer += popcntBitmapRange(a.(*bitmapContainer).bitmap, int(iv.start), iv.last()+1)
+		}
+		return answer
+	case *runContainer:
+		return rc.andCardinalityRun(a.(*runContainer))
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) xorCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer, *bitmapContainer, *runContainer:
+		return rc.getCardinality() + a.getCardinality() - 2*rc.andCardinality(a)
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) andNotCardinality(a container) int {
+	switch a.(type) {
+	case *arrayContainer, *bitmapContainer, *runContainer:
+		return rc.getCardinality() - rc.andCardinality(a)
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) isSubset(a container) bool {
+	switch a.(type) {
+	case *arrayContainer, *bitmapContainer, *runContainer:
+		for _, iv := range rc.iv {
+			if !a.containsRange(int(iv.start), iv.last()+1) {
+				return false
+			}
+		}
+		return true
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) andCardinalityRun(value2 *runContainer) int {
+	answer := 0
+	i, j := 0, 0
+	for i < len(rc.iv) && j < len(value2.iv) {
+		start := int(rc.iv[i].start)
+		if int(value2.iv[j].start) > start {
+			start = int(value2.iv[j].start)
+		}
+		last := rc.iv[i].last()
+		if value2.iv[j].last() < last {
+			last = value2.iv[j].last()
+			j++
+		} else {
+			i++
+		}
+		if last >= start {
+			answer += last - start + 1
+		}
+	}
+	return answer
+}
+
+func (rc *runContainer) intersectsArray(value2 *arrayContainer) bool {
+	i := 0
+	for _, v := range value2.content {
+		for i < len(rc.iv) && rc.iv[i].last() < int(v) {
+			i++
+		}
+		if i == len(rc.iv) {
+			return false
+		}
+		if v >= rc.iv[i].start {
+			return true
+		}
+	}
+	return false
+}
+
+func (rc *runContainer) intersectsBitmap(value2 *bitmapContainer) bool {
+	for _, iv := range rc.iv {
+		i := value2.NextSetBit(int(iv.start))
+		if i < 0 {
+			return false
+		}
+		if i <= iv.last() {
+			return true
+		}
+	}
+	return false
+}
+
+func (rc *runContainer) intersectsRun(value2 *runContainer) bool {
+	i, j := 0, 0
+	for i < len(rc.iv) && j < len(value2.iv) {
+		if rc.iv[i].last() < int(value2.iv[j].start) {
+			i++
+		} else if value2.iv[j].last() < int(rc.iv[i].start) {
+			j++
+		} else {
+			return true
+		}
+	}
+	return false
+}
+
+func (rc *runContainer) xor(a container) container {
+	switch a.(type) {
+	case *arrayContainer:
+		return rc.xorArray(a.(*arrayContainer))
+	case *bitmapContainer:
+		return rc.xorBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return rc.xorRun(a.(*runContainer))
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) xorArray(value2 *arrayContainer) container {
+	return rc.xorRun(newRunContainerFromArray(value2))
+}
+
+func (rc *runContainer) xorBitmap(value2 *bitmapContainer) container {
+	answer := value2.clone().(*bitmapContainer)
+	for _, iv := range rc.iv {
+		flipBitmapRange(answer.bitmap, int(iv.start), iv.last()+1)
+	}
+	answer.computeCardinality()
+	if answer.cardinality <= arrayDefaultMaxSize {
+		return answer.toArrayContainer()
+	}
+	return answer
+}
+
+func (rc *runContainer) xorRun(value2 *runContainer) container {
+	answer := &runContainer{xorIntervals(rc.iv, value2.iv)}
+	return answer.toEfficientContainer()
+}
+
+func (rc *runContainer) andNot(a container) container {
+	switch a.(type) {
+	case *arrayContainer:
+		return rc.andNotArray(a.(*arrayContainer))
+	case *bitmapContainer:
+		return rc.andNotBitmap(a.(*bitmapContainer))
+	case *runContainer:
+		return rc.andNotRun(a.(*runContainer))
+	}
+	panic("should never happen")
+}
+
+func (rc *runContainer) iandNot(a container) container {
+	return rc.andNot(a)
+}
+
+func (rc *runContainer) andNotArray(value2 *arrayContainer) container {
+	return rc.andNotRun(newRunContainerFromArray(value2))
+}
+
+func (rc *runContainer) andNotBitmap(value2 *bitmapContainer) container {
+	card := rc.getCardinality()
+	if card <= arrayDefaultMaxSize {
+		answer := newArrayContainerCapacity(card)
+		for _, iv := range rc.iv {
+			for v := int(iv.start); v <= iv.last(); v++ {
+				if !value2.contains(uint16(v)) {
+					answer.content = append(answer.content, uint16(v))
+				}
+			}
+		}
+		return answer
+	}
+	return rc.toBitmapContainer().andNotBitmap(value2)
+}
+
+func (rc *runContainer) andNotRun(value2 *runContainer) container {
+	answer := &runContainer{differenceIntervals(rc.iv, value2.iv)}
+	return answer.toEfficientContainer()
+}
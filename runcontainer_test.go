@@ -0,0 +1,202 @@
+package roaring
+
+// to run just these tests: go test -run TestRunContainer*
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// makeRunContainers returns the same random set as a run container and as a
+// plain array or bitmap container
+func makeRunContainers(r *rand.Rand, runs, maxlength int) (*runContainer, container) {
+	rc := newRunContainer()
+	var other container = newArrayContainer()
+	for i := 0; i < runs; i++ {
+		start := r.Intn(maxCapacity)
+		end := start + 1 + r.Intn(maxlength)
+		if end > maxCapacity {
+			end = maxCapacity
+		}
+		rc.iaddRange(start, end)
+		other = other.iaddRange(start, end)
+	}
+	return rc, other
+}
+
+func sameContent(a, b container) bool {
+	if a.getCardinality() != b.getCardinality() {
+		return false
+	}
+	sa := a.getShortIterator()
+	sb := b.getShortIterator()
+	for sa.hasNext() {
+		if !sb.hasNext() || sa.next() != sb.next() {
+			return false
+		}
+	}
+	return !sb.hasNext()
+}
+
+func TestRunContainerAddRemove(t *testing.T) {
+	rc := newRunContainer()
+	for _, v := range []uint16{5, 7, 6, 10, 4, 65535, 0, 8} {
+		rc.add(v)
+	}
+	if rc.numberOfRuns() != 4 {
+		t.Errorf("Bad number of runs %d.", rc.numberOfRuns())
+	}
+	if rc.getCardinality() != 8 {
+		t.Errorf("Bad cardinality %d.", rc.getCardinality())
+	}
+	rc.remove(6)
+	rc.remove(4)
+	rc.remove(65535)
+	rc.remove(1000)
+	if !checkContent(rc, []uint16{0, 5, 7, 8, 10}) {
+		t.Errorf("Bad content after removals.")
+	}
+	if rc.contains(6) || !rc.contains(7) {
+		t.Errorf("Bad contains.")
+	}
+}
+
+func TestRunContainerRankSelect(t *testing.T) {
+	rc := newRunContainerRange(10, 19)
+	rc.iaddRange(100, 110)
+	for i := 0; i < rc.getCardinality(); i++ {
+		x := rc.selectInt(uint16(i))
+		if rc.rank(uint16(x)) != i+1 {
+			t.Errorf("At %d rank and select disagree.", i)
+		}
+	}
+	if rc.rank(9) != 0 || rc.rank(50) != 10 || rc.rank(65535) != 20 {
+		t.Errorf("Bad rank.")
+	}
+}
+
+func TestRunContainerFull(t *testing.T) {
+	rc := newRunContainerRange(0, maxCapacity-1)
+	if rc.getCardinality() != maxCapacity || !rc.isFull() {
+		t.Errorf("Bad full container.")
+	}
+	if rc.serializedSizeInBytes() != 6 {
+		t.Errorf("Full container should serialize to 6 bytes.")
+	}
+	c := rc.not(0, maxCapacity-1)
+	if c.getCardinality() != 0 {
+		t.Errorf("Negating a full container should be empty.")
+	}
+}
+
+func TestRunContainerConversions(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		rc, other := makeRunContainers(r, 1+r.Intn(100), 1+r.Intn(2000))
+		if !sameContent(rc, other) {
+			t.Fatalf("Run container does not match reference.")
+		}
+		if !sameContent(newRunContainerFromArray(rc.toArrayContainer()), rc) {
+			t.Errorf("Bad array round trip.")
+		}
+		if !sameContent(newRunContainerFromBitmap(rc.toBitmapContainer()), rc) {
+			t.Errorf("Bad bitmap round trip.")
+		}
+		if !rc.equals(other) || !other.equals(rc) {
+			t.Errorf("Equal containers of different types should be equal.")
+		}
+	}
+}
+
+func TestRunContainerOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		rc1, c1 := makeRunContainers(r, 1+r.Intn(100), 1+r.Intn(2000))
+		rc2, c2 := makeRunContainers(r, 1+r.Intn(100), 1+r.Intn(2000))
+		for _, other := range []container{rc2, c2} {
+			if !sameContent(rc1.and(other), c1.and(c2)) || !sameContent(c1.and(rc2), c1.and(c2)) {
+				t.Fatalf("Bad and.")
+			}
+			if !sameContent(rc1.or(other), c1.or(c2)) || !sameContent(c1.or(rc2), c1.or(c2)) {
+				t.Fatalf("Bad or.")
+			}
+			if !sameContent(rc1.xor(other), c1.xor(c2)) || !sameContent(c1.xor(rc2), c1.xor(c2)) {
+				t.Fatalf("Bad xor.")
+			}
+			if !sameContent(rc1.andNot(other), c1.andNot(c2)) || !sameContent(c1.andNot(rc2), c1.andNot(c2)) {
+				t.Fatalf("Bad andNot.")
+			}
+			if rc1.intersects(other) != c1.intersects(c2) || c1.intersects(rc2) != c1.intersects(c2) {
+				t.Fatalf("Bad intersects.")
+			}
+		}
+		if !sameContent(c1.clone().iand(rc2), c1.and(c2)) {
+			t.Fatalf("Bad iand.")
+		}
+		if !sameContent(c1.clone().ior(rc2), c1.or(c2)) {
+			t.Fatalf("Bad ior.")
+		}
+		if !sameContent(c1.clone().iandNot(rc2), c1.andNot(c2)) {
+			t.Fatalf("Bad iandNot.")
+		}
+		if !sameContent(rc1.clone().iand(c2), c1.and(c2)) {
+			t.Fatalf("Bad run iand.")
+		}
+		if !sameContent(rc1.clone().ior(c2), c1.or(c2)) {
+			t.Fatalf("Bad run ior.")
+		}
+		if !sameContent(rc1.clone().iandNot(c2), c1.andNot(c2)) {
+			t.Fatalf("Bad run iandNot.")
+		}
+	}
+}
+
+func TestRunContainerRanges(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 200; i++ {
+		rc, c := makeRunContainers(r, 1+r.Intn(50), 1+r.Intn(2000))
+		start := r.Intn(maxCapacity)
+		end := start + 1 + r.Intn(maxCapacity-start)
+		if !sameContent(rc.addRange(start, end), c.addRange(start, end)) {
+			t.Fatalf("Bad addRange.")
+		}
+		if !sameContent(rc.removeRange(start, end), c.removeRange(start, end)) {
+			t.Fatalf("Bad removeRange.")
+		}
+		if !sameContent(rc.not(start, end-1), c.not(start, end-1)) {
+			t.Fatalf("Bad not.")
+		}
+		if !sameContent(rc.clone().inot(start, end-1), c.clone().inot(start, end-1)) {
+			t.Fatalf("Bad inot.")
+		}
+		if !sameContent(rc.clone().iremoveRange(start, end), c.clone().iremoveRange(start, end)) {
+			t.Fatalf("Bad iremoveRange.")
+		}
+		x := uint16(r.Intn(maxCapacity))
+		if rc.rank(x) != c.rank(x) {
+			t.Fatalf("Bad rank.")
+		}
+	}
+}
+
+func TestRunContainerSerialization(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	rc, _ := makeRunContainers(r, 100, 100)
+	buf := new(bytes.Buffer)
+	n, err := rc.writeTo(buf)
+	if err != nil {
+		t.Fatalf("Failed writing: %v", err)
+	}
+	if n != rc.serializedSizeInBytes() {
+		t.Errorf("Bad serializedSizeInBytes.")
+	}
+	newrc := newRunContainer()
+	_, err = newrc.readFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed reading: %v", err)
+	}
+	if !rc.equals(newrc) {
+		t.Errorf("Cannot retrieve serialized version.")
+	}
+}
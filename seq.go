@@ -0,0 +1,22 @@
+//go:build go1.23
+// +build go1.23
+
+package roaring
+
+import "iter"
+
+// Values returns an iterator over the integers contained in the bitmap, in
+// sorted order, for use with range:
+//
+//	for x := range rb.Values() {
+//		...
+//	}
+func (rb *RoaringBitmap) Values() iter.Seq[uint32] {
+	return rb.Iterate
+}
+
+// Ranges returns an iterator over the maximal ranges [start,last] of
+// consecutive integers contained in the bitmap, both bounds being included
+func (rb *RoaringBitmap) Ranges() iter.Seq2[uint32, uint32] {
+	return rb.iterateRanges
+}
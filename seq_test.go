@@ -0,0 +1,57 @@
+//go:build go1.23
+// +build go1.23
+
+package roaring
+
+import "testing"
+
+func TestValuesRanges(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 5, 65535, 65536, 65537, 4294967295)
+	rb.AddRange(100, 200)
+	rb.AddRange(1<<17-10, 1<<18+10)
+	for i := 500000; i < 600000; i += 2 {
+		rb.AddInt(i)
+	}
+	for _, optimize := range []bool{false, true} {
+		if optimize {
+			rb.RunOptimize()
+		}
+		values := rb.ToArray()
+		i := 0
+		for x := range rb.Values() {
+			if x != values[i] {
+				t.Fatalf("Bad value %d at %d, expected %d", x, i, values[i])
+			}
+			i++
+		}
+		if i != len(values) {
+			t.Fatalf("Bad number of values %d", i)
+		}
+		var ranges [][2]uint32
+		for start, last := range rb.Ranges() {
+			ranges = append(ranges, [2]uint32{start, last})
+		}
+		if len(ranges) != 50000+6 {
+			t.Fatalf("Bad number of ranges %d", len(ranges))
+		}
+		expected := [][2]uint32{{1, 3}, {5, 5}, {100, 199}, {65535, 65537}, {1<<17 - 10, 1<<18 + 9}, {500000, 500000}}
+		for k, r := range expected {
+			if ranges[k] != r {
+				t.Errorf("Bad range %v, expected %v", ranges[k], r)
+			}
+		}
+		if ranges[len(ranges)-1] != [2]uint32{4294967295, 4294967295} {
+			t.Errorf("Bad last range %v", ranges[len(ranges)-1])
+		}
+		count := uint64(0)
+		for start, last := range rb.Ranges() {
+			if start > 65535 {
+				break
+			}
+			count += uint64(last-start) + 1
+		}
+		if count != 4+100+3 {
+			t.Errorf("Bad count %d after breaking", count)
+		}
+	}
+}
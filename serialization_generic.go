@@ -49,3 +49,59 @@ func (b *bitmapContainer) readFrom(stream io.Reader) (int, error) {
 	}
 	return 8 * len(b.bitmap), nil
 }
+
+func (b *runContainer) writeTo(stream io.Writer) (int, error) {
+	buf := make([]byte, 2+4*len(b.iv))
+	binary.LittleEndian.PutUint16(buf, uint16(len(b.iv)))
+	for i, v := range b.iv {
+		base := 2 + i*4
+		binary.LittleEndian.PutUint16(buf[base:], v.start)
+		binary.LittleEndian.PutUint16(buf[base+2:], v.length)
+	}
+	return stream.Write(buf)
+}
+
+func (b *runContainer) readFrom(stream io.Reader) (int, error) {
+	var nr uint16
+	err := binary.Read(stream, binary.LittleEndian, &nr)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]uint16, 2*int(nr))
+	err = binary.Read(stream, binary.LittleEndian, buf)
+	if err != nil {
+		return 0, err
+	}
+	b.iv = make([]interval16, nr)
+	for i := range b.iv {
+		b.iv[i] = interval16{buf[2*i], buf[2*i+1]}
+	}
+	return 2 + 4*len(b.iv), nil
+}
+
+// the byteSliceAs functions cannot alias the buffer on this platform, they
+// decode a copy of it instead
+
+func byteSliceAsUint16Slice(slice []byte) []uint16 {
+	answer := make([]uint16, len(slice)/2)
+	for i := range answer {
+		answer[i] = binary.LittleEndian.Uint16(slice[2*i:])
+	}
+	return answer
+}
+
+func byteSliceAsUint64Slice(slice []byte) []uint64 {
+	answer := make([]uint64, len(slice)/8)
+	for i := range answer {
+		answer[i] = binary.LittleEndian.Uint64(slice[8*i:])
+	}
+	return answer
+}
+
+func byteSliceAsInterval16Slice(slice []byte) []interval16 {
+	answer := make([]interval16, len(slice)/4)
+	for i := range answer {
+		answer[i] = interval16{binary.LittleEndian.Uint16(slice[4*i:]), binary.LittleEndian.Uint16(slice[4*i+2:])}
+	}
+	return answer
+}
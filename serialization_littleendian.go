@@ -3,8 +3,8 @@
 package roaring
 
 import (
+	"encoding/binary"
 	"io"
-	"reflect"
 	"unsafe"
 )
 
@@ -18,6 +18,13 @@ func (b *bitmapContainer) writeTo(stream io.Writer) (int, error) {
 	return stream.Write(buf)
 }
 
+func (b *runContainer) writeTo(stream io.Writer) (int, error) {
+	buf := make([]byte, 2, 2+4*len(b.iv))
+	binary.LittleEndian.PutUint16(buf, uint16(len(b.iv)))
+	buf = append(buf, interval16SliceAsByteSlice(b.iv)...)
+	return stream.Write(buf)
+}
+
 func (b *arrayContainer) readFrom(stream io.Reader) (int, error) {
 	buf := uint16SliceAsByteSlice(b.content)
 	return io.ReadFull(stream, buf)
@@ -28,26 +35,55 @@ func (b *bitmapContainer) readFrom(stream io.Reader) (int, error) {
 	return io.ReadFull(stream, buf)
 }
 
+func (b *runContainer) readFrom(stream io.Reader) (int, error) {
+	var nr [2]byte
+	n, err := io.ReadFull(stream, nr[:])
+	if err != nil {
+		return n, err
+	}
+	b.iv = make([]interval16, binary.LittleEndian.Uint16(nr[:]))
+	m, err := io.ReadFull(stream, interval16SliceAsByteSlice(b.iv))
+	return n + m, err
+}
+
 func uint64SliceAsByteSlice(slice []uint64) []byte {
-	// make a new slice header
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&slice))
+	if len(slice) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&slice[0])), 8*len(slice))
+}
 
-	// update its capacity and length
-	header.Len *= 8
-	header.Cap *= 8
+func uint16SliceAsByteSlice(slice []uint16) []byte {
+	if len(slice) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&slice[0])), 2*len(slice))
+}
 
-	// return it
-	return *(*[]byte)(unsafe.Pointer(&header))
+func interval16SliceAsByteSlice(slice []interval16) []byte {
+	if len(slice) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&slice[0])), 4*len(slice))
 }
 
-func uint16SliceAsByteSlice(slice []uint16) []byte {
-	// make a new slice header
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&slice))
+func byteSliceAsUint16Slice(slice []byte) []uint16 {
+	if len(slice) < 2 {
+		return nil
+	}
+	return unsafe.Slice((*uint16)(unsafe.Pointer(&slice[0])), len(slice)/2)
+}
 
-	// update its capacity and length
-	header.Len *= 2
-	header.Cap *= 2
+func byteSliceAsUint64Slice(slice []byte) []uint64 {
+	if len(slice) < 8 {
+		return nil
+	}
+	return unsafe.Slice((*uint64)(unsafe.Pointer(&slice[0])), len(slice)/8)
+}
 
-	// return it
-	return *(*[]byte)(unsafe.Pointer(&header))
+func byteSliceAsInterval16Slice(slice []byte) []interval16 {
+	if len(slice) < 4 {
+		return nil
+	}
+	return unsafe.Slice((*interval16)(unsafe.Pointer(&slice[0])), len(slice)/4)
 }
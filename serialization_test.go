@@ -4,6 +4,10 @@ package roaring
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"math/rand"
 	"testing"
 )
 
@@ -30,6 +34,70 @@ func TestBase64(t *testing.T) {
 
 }
 
+func binaryTestBitmaps() map[string]*RoaringBitmap {
+	arrays := BitmapOf(1, 2, 3, 100, 1000, 100000, 1000000)
+	bitmaps := NewRoaringBitmap()
+	for i := 0; i < 300000; i += 3 {
+		bitmaps.AddInt(i)
+	}
+	mixed := BitmapOf(1, 2, 3, 100000)
+	for i := 200000; i < 300000; i += 7 {
+		mixed.AddInt(i)
+	}
+	mixed.AddRange(1000000, 1200000)
+	runs := mixed.Clone()
+	runs.RunOptimize()
+	return map[string]*RoaringBitmap{
+		"empty":  NewRoaringBitmap(),
+		"array":  arrays,
+		"bitmap": bitmaps,
+		"mixed":  mixed,
+		"runs":   runs,
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	for name, rb := range binaryTestBitmaps() {
+		data, err := rb.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: failed marshaling: %v", name, err)
+		}
+		if len(data) != int(rb.GetSerializedSizeInBytes()) {
+			t.Errorf("%s: bad size", name)
+		}
+		newrb := BitmapOf(42)
+		if err = newrb.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: failed unmarshaling: %v", name, err)
+		}
+		if !rb.Equals(newrb) {
+			t.Errorf("%s: cannot retrieve marshaled version", name)
+		}
+	}
+	if err := NewRoaringBitmap().UnmarshalBinary([]byte{1, 2, 3}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Truncated input gave %v", err)
+	}
+}
+
+func TestGob(t *testing.T) {
+	type record struct {
+		Name   string
+		Bitmap *RoaringBitmap
+	}
+	for name, rb := range binaryTestBitmaps() {
+		buf := new(bytes.Buffer)
+		if err := gob.NewEncoder(buf).Encode(record{name, rb}); err != nil {
+			t.Fatalf("%s: failed encoding: %v", name, err)
+		}
+		var decoded record
+		if err := gob.NewDecoder(buf).Decode(&decoded); err != nil {
+			t.Fatalf("%s: failed decoding: %v", name, err)
+		}
+		if decoded.Name != name || !rb.Equals(decoded.Bitmap) {
+			t.Errorf("%s: cannot retrieve gob encoded version", name)
+		}
+	}
+}
+
 func TestSerializationBasic(t *testing.T) {
 	rb := BitmapOf(1, 2, 3, 4, 5, 100, 1000)
 	l := int(rb.GetSerializedSizeInBytes())
@@ -95,3 +163,269 @@ func TestSerializationBasic3(t *testing.T) {
 		t.Errorf("Cannot retrieve serialized version")
 	}
 }
+
+func TestSerializationRunContainer(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 4, 5, 100, 1000, 10000, 100000, 1000000)
+	rb.AddRange(200000, 300000)
+	rb.AddRange(5000000, 5000000+3*(1<<16))
+	for i := 7000000; i < 7000000+10000; i += 2 {
+		rb.AddInt(i)
+	}
+	rb.RunOptimize()
+	if !rb.HasRunCompression() {
+		t.Fatalf("Expected run containers")
+	}
+	l := int(rb.GetSerializedSizeInBytes())
+	buf := new(bytes.Buffer)
+	n, err := rb.WriteTo(buf)
+	if err != nil {
+		t.Errorf("Failed writing")
+	}
+	if l != buf.Len() || n != buf.Len() {
+		t.Errorf("Bad GetSerializedSizeInBytes")
+	}
+	newrb := NewRoaringBitmap()
+	n, err = newrb.ReadFrom(buf)
+	if err != nil {
+		t.Errorf("Failed reading")
+	}
+	if n != l {
+		t.Errorf("Bad number of bytes read")
+	}
+	if !rb.Equals(newrb) {
+		t.Errorf("Cannot retrieve serialized version")
+	}
+	if !newrb.HasRunCompression() {
+		t.Errorf("Run containers were not preserved")
+	}
+}
+
+func TestSerializationRunFormat(t *testing.T) {
+	// a single run [0,100) packs the size with the cookie and has no offsets
+	rb := NewRoaringBitmap()
+	rb.AddRange(0, 100)
+	rb.RunOptimize()
+	expected := []byte{
+		0x3B, 0x30, 0x00, 0x00, // cookie 12347, one container
+		0x01,                   // run bitset
+		0x00, 0x00, 0x63, 0x00, // key 0, cardinality 100
+		0x01, 0x00, 0x00, 0x00, 0x63, 0x00, // one run: start 0, length 100
+	}
+	buf := new(bytes.Buffer)
+	_, err := rb.WriteTo(buf)
+	if err != nil {
+		t.Errorf("Failed writing")
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Unexpected serialized bytes %v", buf.Bytes())
+	}
+
+	// with four containers or more, the offsets follow the keys
+	data := []byte{
+		0x3B, 0x30, 0x03, 0x00, // cookie 12347, four containers
+		0x05,                   // containers 0 and 2 are runs
+		0x00, 0x00, 0x09, 0x00, // key 0, cardinality 10
+		0x01, 0x00, 0x01, 0x00, // key 1, cardinality 2
+		0x02, 0x00, 0x00, 0x01, // key 2, cardinality 257
+		0x03, 0x00, 0x00, 0x00, // key 3, cardinality 1
+		0x25, 0x00, 0x00, 0x00, 0x2B, 0x00, 0x00, 0x00,
+		0x2F, 0x00, 0x00, 0x00, 0x39, 0x00, 0x00, 0x00, // offsets
+		0x01, 0x00, 0x05, 0x00, 0x09, 0x00, // [5,14]
+		0x07, 0x00, 0x09, 0x00, // 7, 9
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0x00, // 0, [65280,65535]
+		0x2A, 0x00, // 42
+	}
+	newrb := NewRoaringBitmap()
+	n, err := newrb.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("Failed reading")
+	}
+	if n != len(data) {
+		t.Errorf("Read %d bytes instead of %d", n, len(data))
+	}
+	rb = BitmapOf(65536+7, 65536+9, 131072, 196608+42)
+	rb.AddRange(5, 15)
+	rb.AddRange(131072+65280, 196608)
+	if !rb.Equals(newrb) {
+		t.Errorf("Unexpected content %v", newrb)
+	}
+	rb.RunOptimize()
+	buf.Reset()
+	_, err = rb.WriteTo(buf)
+	if err != nil {
+		t.Errorf("Failed writing")
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("Unexpected serialized bytes %v", buf.Bytes())
+	}
+}
+
+func serializedTestBitmap(t *testing.T, runs bool) []byte {
+	rb := BitmapOf(1, 2, 3, 4, 5, 100, 1000, 10000, 100000, 1000000)
+	rb.AddRange(200000, 300000)
+	for i := 5000000; i < 5000000+10000; i += 3 {
+		rb.AddInt(i)
+	}
+	if runs {
+		rb.RunOptimize()
+	}
+	buf := new(bytes.Buffer)
+	_, err := rb.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("Failed writing")
+	}
+	return buf.Bytes()
+}
+
+func TestSerializationTruncated(t *testing.T) {
+	for _, runs := range []bool{false, true} {
+		data := serializedTestBitmap(t, runs)
+		for l := 0; l < len(data); l++ {
+			rb := NewRoaringBitmap()
+			_, err := rb.ReadFrom(bytes.NewReader(data[:l]))
+			if !errors.Is(err, ErrTruncated) {
+				t.Fatalf("Reading %d of %d bytes gave %v", l, len(data), err)
+			}
+			if !rb.IsEmpty() {
+				t.Fatalf("Failed read should leave the bitmap empty")
+			}
+		}
+	}
+}
+
+func TestSerializationCorrupt(t *testing.T) {
+	data := serializedTestBitmap(t, false)
+	corrupt := func(f func(b []byte)) error {
+		b := make([]byte, len(data))
+		copy(b, data)
+		f(b)
+		_, err := NewRoaringBitmap().ReadFrom(bytes.NewReader(b))
+		return err
+	}
+	if err := corrupt(func(b []byte) { b[0] = 0 }); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("Bad cookie gave %v", err)
+	}
+	if err := corrupt(func(b []byte) { binary.LittleEndian.PutUint32(b[4:], 100000) }); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Bad size gave %v", err)
+	}
+	if err := corrupt(func(b []byte) { binary.LittleEndian.PutUint16(b[12:], 0) }); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Unsorted keys gave %v", err)
+	}
+	if err := corrupt(func(b []byte) { b[8+4*8]++ }); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Bad offset gave %v", err)
+	}
+	first := int(binary.LittleEndian.Uint32(data[8+4*8:]))
+	if err := corrupt(func(b []byte) { b[first] = 0xFF }); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Unsorted array gave %v", err)
+	}
+	// the bitmap container for [200000,262144) is the fourth container
+	bitmapat := int(binary.LittleEndian.Uint32(data[8+4*8+3*4:]))
+	if err := corrupt(func(b []byte) { b[bitmapat+100] ^= 0x10 }); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Bad bitmap cardinality gave %v", err)
+	}
+
+	runs := []byte{
+		0x3B, 0x30, 0x00, 0x00, 0x01, 0x00, 0x00, 0x0A, 0x00,
+		0x02, 0x00, 0x00, 0x00, 0x05, 0x00, 0x05, 0x00, 0x05, 0x00, // [0,5] and [5,10]
+	}
+	_, err := NewRoaringBitmap().ReadFrom(bytes.NewReader(runs))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Overlapping runs gave %v", err)
+	}
+	runs[15], runs[17] = 6, 4 // [0,5] and [6,10] are merged
+	rb := NewRoaringBitmap()
+	_, err = rb.ReadFrom(bytes.NewReader(runs))
+	if err != nil || rb.GetCardinality() != 11 {
+		t.Errorf("Adjacent runs gave %v", err)
+	}
+}
+
+func TestSerializationFuzz(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, runs := range []bool{false, true} {
+		data := serializedTestBitmap(t, runs)
+		for i := 0; i < 2000; i++ {
+			b := make([]byte, len(data))
+			copy(b, data)
+			for j := 0; j < 1+r.Intn(4); j++ {
+				b[r.Intn(64)%len(b)] = byte(r.Intn(256))
+			}
+			rb := NewRoaringBitmap()
+			_, err := rb.ReadFrom(bytes.NewReader(b))
+			if err == nil && int(rb.GetSerializedSizeInBytes()) > len(b) {
+				t.Fatalf("Accepted inconsistent input")
+			}
+		}
+	}
+}
+
+func TestFromBuffer(t *testing.T) {
+	for _, runs := range []bool{false, true} {
+		data := serializedTestBitmap(t, runs)
+		expected := NewRoaringBitmap()
+		_, err := expected.ReadFrom(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed reading: %v", err)
+		}
+		rb := NewRoaringBitmap()
+		n, err := rb.FromBuffer(data)
+		if err != nil {
+			t.Fatalf("Failed loading buffer: %v", err)
+		}
+		if n != len(data) {
+			t.Errorf("Read %d of %d bytes", n, len(data))
+		}
+		if !rb.Equals(expected) {
+			t.Errorf("FromBuffer and ReadFrom disagree")
+		}
+		for l := 0; l < len(data); l++ {
+			_, err := NewRoaringBitmap().FromBuffer(data[:l])
+			if !errors.Is(err, ErrTruncated) {
+				t.Fatalf("Loading %d of %d bytes gave %v", l, len(data), err)
+			}
+		}
+	}
+	_, err := NewRoaringBitmap().FromBuffer([]byte{0, 0, 0, 0, 0, 0, 0, 0})
+	if !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("Bad cookie gave %v", err)
+	}
+}
+
+func TestFromBufferCopyOnWrite(t *testing.T) {
+	mutations := map[string]func(rb *RoaringBitmap){
+		"Add":         func(rb *RoaringBitmap) { rb.Add(6) },
+		"CheckedAdd":  func(rb *RoaringBitmap) { rb.CheckedAdd(200) },
+		"Remove":      func(rb *RoaringBitmap) { rb.Remove(3) },
+		"AddRange":    func(rb *RoaringBitmap) { rb.AddRange(0, 6000000) },
+		"RemoveRange": func(rb *RoaringBitmap) { rb.RemoveRange(2, 5000100) },
+		"Flip":        func(rb *RoaringBitmap) { rb.Flip(0, 6000000) },
+		"And":         func(rb *RoaringBitmap) { rb.And(BitmapOf(1, 250000, 5000003)) },
+		"AndNot":      func(rb *RoaringBitmap) { rb.AndNot(BitmapOf(1, 250000, 5000003)) },
+		"Or":          func(rb *RoaringBitmap) { rb.Or(BitmapOf(6, 250001, 5000004)) },
+		"Xor":         func(rb *RoaringBitmap) { rb.Xor(BitmapOf(1, 250000, 5000004)) },
+		"RunOptimize": func(rb *RoaringBitmap) { rb.RunOptimize() },
+	}
+	for _, runs := range []bool{false, true} {
+		data := serializedTestBitmap(t, runs)
+		for name, mutate := range mutations {
+			buf := make([]byte, len(data))
+			copy(buf, data)
+			rb := NewRoaringBitmap()
+			if _, err := rb.FromBuffer(buf); err != nil {
+				t.Fatalf("Failed loading buffer: %v", err)
+			}
+			expected := NewRoaringBitmap()
+			if _, err := expected.ReadFrom(bytes.NewReader(data)); err != nil {
+				t.Fatalf("Failed reading: %v", err)
+			}
+			mutate(rb)
+			mutate(expected)
+			if !bytes.Equal(buf, data) {
+				t.Errorf("%s modified the buffer", name)
+			}
+			if !rb.Equals(expected) {
+				t.Errorf("%s gave a bad result", name)
+			}
+		}
+	}
+}
@@ -216,6 +216,57 @@ func intersection2by2(
 	}
 }
 
+// intersection2by2Cardinality counts the values that are in both sets
+func intersection2by2Cardinality(set1 []uint16, set2 []uint16) int {
+	if len(set1) > len(set2) {
+		set1, set2 = set2, set1
+	}
+	answer := 0
+	if len(set1)*64 < len(set2) {
+		k2 := 0
+		for _, v := range set1 {
+			k2 = advanceUntil(set2, k2-1, len(set2), v)
+			if k2 == len(set2) {
+				break
+			}
+			if set2[k2] == v {
+				answer++
+				k2++
+			}
+		}
+		return answer
+	}
+	k1, k2 := 0, 0
+	for k1 < len(set1) && k2 < len(set2) {
+		if set1[k1] < set2[k2] {
+			k1++
+		} else if set1[k1] > set2[k2] {
+			k2++
+		} else {
+			answer++
+			k1++
+			k2++
+		}
+	}
+	return answer
+}
+
+// subset2by2 checks whether all the values of set1 are in set2
+func subset2by2(set1 []uint16, set2 []uint16) bool {
+	if len(set1) > len(set2) {
+		return false
+	}
+	k2 := 0
+	for _, v := range set1 {
+		k2 = advanceUntil(set2, k2-1, len(set2), v)
+		if k2 == len(set2) || set2[k2] != v {
+			return false
+		}
+		k2++
+	}
+	return true
+}
+
 func intersects2by2(
 	set1 []uint16,
 	set2 []uint16) bool {
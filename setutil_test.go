@@ -109,6 +109,22 @@ func TestSetUtilIntersection2(t *testing.T) {
 	}
 }
 
+func TestSetUtilIntersectionCardinality(t *testing.T) {
+	data1 := []uint16{0, 2, 4, 6, 8, 10, 12, 14, 16, 18}
+	data2 := []uint16{0, 3, 6, 9, 12, 15, 18}
+	if intersection2by2Cardinality(data1, data2) != 4 || intersection2by2Cardinality(data2, data1) != 4 {
+		t.Errorf("Intersection cardinality is broken")
+	}
+	large := make([]uint16, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		large = append(large, uint16(3*i))
+	}
+	small := []uint16{0, 1, 2, 3, 299, 300, 5997, 5998}
+	if intersection2by2Cardinality(small, large) != 4 || intersection2by2Cardinality(large, small) != 4 {
+		t.Errorf("Galloping intersection cardinality is broken")
+	}
+}
+
 func TestSetUtilBinarySearch(t *testing.T) {
 	data := make([]uint16, 256)
 	for i := range data {
@@ -0,0 +1,32 @@
+package roaring
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Scan implements the sql.Scanner interface, accepting the portable format
+// as a []byte, as stored in bytea or BLOB columns, or as a base64 string.
+// A NULL value empties the bitmap.
+func (rb *RoaringBitmap) Scan(src interface{}) error {
+	switch src.(type) {
+	case nil:
+		rb.Clear()
+		return nil
+	case []byte:
+		return rb.UnmarshalBinary(src.([]byte))
+	case string:
+		_, err := rb.FromBase64(src.(string))
+		return err
+	}
+	return fmt.Errorf("roaring: cannot scan %T into a RoaringBitmap", src)
+}
+
+// Value implements the driver.Valuer interface, returning the portable
+// format as a []byte. A nil bitmap is stored as NULL.
+func (rb *RoaringBitmap) Value() (driver.Value, error) {
+	if rb == nil {
+		return nil, nil
+	}
+	return rb.MarshalBinary()
+}
@@ -0,0 +1,163 @@
+package roaring
+
+// to run just these tests: go test -run TestSQL*
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver stores single values by key: "SET key" binds its argument to
+// key, "GET key" returns it as a single row with a single column
+type fakeDriver struct {
+	sync.Mutex
+	values map[string]driver.Value
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+type fakeStmt struct {
+	d     *fakeDriver
+	op    string
+	key   string
+	numIn int
+}
+
+type fakeRows struct {
+	value driver.Value
+	done  bool
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	fields := strings.Fields(query)
+	if len(fields) != 2 || (fields[0] != "SET" && fields[0] != "GET") {
+		return nil, errors.New("fake driver: bad query")
+	}
+	s := &fakeStmt{d: c.d, op: fields[0], key: fields[1]}
+	if s.op == "SET" {
+		s.numIn = 1
+	}
+	return s, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake driver: no transactions")
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return s.numIn
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.Lock()
+	defer s.d.Unlock()
+	s.d.values[s.key] = args[0]
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.Lock()
+	defer s.d.Unlock()
+	return &fakeRows{value: s.d.values[s.key]}, nil
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"bitmap"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+var fakeDB = &fakeDriver{values: make(map[string]driver.Value)}
+
+func init() {
+	sql.Register("roaringfake", fakeDB)
+}
+
+func TestSQL(t *testing.T) {
+	db, err := sql.Open("roaringfake", "")
+	if err != nil {
+		t.Fatalf("Failed opening: %v", err)
+	}
+	defer db.Close()
+	for name, rb := range binaryTestBitmaps() {
+		if _, err = db.Exec("SET "+name, rb); err != nil {
+			t.Fatalf("%s: failed storing: %v", name, err)
+		}
+		if _, ok := fakeDB.values[name].([]byte); !ok {
+			t.Errorf("%s: stored %T, not []byte", name, fakeDB.values[name])
+		}
+		newrb := BitmapOf(42)
+		if err = db.QueryRow("GET " + name).Scan(newrb); err != nil {
+			t.Fatalf("%s: failed loading: %v", name, err)
+		}
+		if !rb.Equals(newrb) {
+			t.Errorf("%s: cannot retrieve stored version", name)
+		}
+	}
+}
+
+func TestSQLScan(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 100000)
+	str, _ := rb.ToBase64()
+	db, err := sql.Open("roaringfake", "")
+	if err != nil {
+		t.Fatalf("Failed opening: %v", err)
+	}
+	defer db.Close()
+	if _, err = db.Exec("SET base64", str); err != nil {
+		t.Fatalf("Failed storing: %v", err)
+	}
+	newrb := NewRoaringBitmap()
+	if err = db.QueryRow("GET base64").Scan(newrb); err != nil || !rb.Equals(newrb) {
+		t.Errorf("Cannot scan a base64 string: %v", err)
+	}
+	if _, err = db.Exec("SET null", nil); err != nil {
+		t.Fatalf("Failed storing: %v", err)
+	}
+	if err = db.QueryRow("GET null").Scan(newrb); err != nil || !newrb.IsEmpty() {
+		t.Errorf("Scanning NULL should empty the bitmap: %v", err)
+	}
+	var nilrb *RoaringBitmap
+	if _, err = db.Exec("SET nil", nilrb); err != nil {
+		t.Fatalf("Failed storing a nil bitmap: %v", err)
+	}
+	if fakeDB.values["nil"] != nil {
+		t.Errorf("A nil bitmap should be stored as NULL, not %v", fakeDB.values["nil"])
+	}
+	if err = newrb.Scan(int64(1)); err == nil {
+		t.Errorf("Scanning an integer should fail")
+	}
+	if err = newrb.Scan([]byte{1, 2, 3}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Scanning truncated bytes gave %v", err)
+	}
+}
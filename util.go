@@ -3,7 +3,9 @@ package roaring
 const (
 	arrayDefaultMaxSize = 4096 // containers with 4096 or fewer integers should be array containers.
 	maxCapacity         = 1 << 16
-	serial_cookie       = 12346
+	serial_cookie       = 12346 // format without run containers
+	serial_cookie_run   = 12347 // format with run containers, the size is packed in the upper 16 bits
+	no_offset_threshold = 4     // run format bitmaps with fewer containers omit the offset header
 )
 
 func getSizeInBytesFromCardinality(card int) int {
@@ -49,6 +51,35 @@ func numberOfTrailingZeros(i uint64) int {
 	return int(n - int64(uint64(x<<1)>>63))
 }
 
+// should be replaced with optimized assembly instructions
+func numberOfLeadingZeros(i uint64) int {
+	if i == 0 {
+		return 64
+	}
+	n := 0
+	if i>>32 == 0 {
+		n += 32
+		i <<= 32
+	}
+	if i>>48 == 0 {
+		n += 16
+		i <<= 16
+	}
+	if i>>56 == 0 {
+		n += 8
+		i <<= 8
+	}
+	if i>>60 == 0 {
+		n += 4
+		i <<= 4
+	}
+	if i>>62 == 0 {
+		n += 2
+		i <<= 2
+	}
+	return n + int(^i>>63)
+}
+
 func fill(arr []uint64, val uint64) {
 	for i := range arr {
 		arr[i] = val
@@ -118,6 +149,44 @@ func lowbits(x uint32) uint16 {
 	return uint16(x & 0xFFFF)
 }
 
+// isSorted reports whether dat is in non-decreasing order
+func isSorted(dat []uint32) bool {
+	for i := 1; i < len(dat); i++ {
+		if dat[i] < dat[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// radixSort sorts dat one byte at a time, from the least significant one,
+// using buf, of the same length, as scratch space. It returns whichever of
+// the two slices holds the sorted integers. Bytes shared by all the
+// integers are skipped.
+func radixSort(dat, buf []uint32) []uint32 {
+	for shift := uint(0); shift < 32; shift += 8 {
+		var offsets [256]int
+		for _, x := range dat {
+			offsets[byte(x>>shift)]++
+		}
+		if len(dat) == 0 || offsets[byte(dat[0]>>shift)] == len(dat) {
+			continue
+		}
+		total := 0
+		for i, count := range offsets {
+			offsets[i] = total
+			total += count
+		}
+		for _, x := range dat {
+			b := byte(x >> shift)
+			buf[offsets[b]] = x
+			offsets[b]++
+		}
+		dat, buf = buf, dat
+	}
+	return dat
+}
+
 func maxLowBit() uint16 {
 	return uint16(0xFFFF)
 }
@@ -175,6 +244,67 @@ func setBitmapRange(bitmap []uint64, start int, end int) {
 	bitmap[endword] |= ^uint64(0) >> (uint(-end) % 64)
 }
 
+// popcntBitmapRange counts the bits set in [start,end)
+func popcntBitmapRange(bitmap []uint64, start int, end int) int {
+	if start >= end {
+		return 0
+	}
+	firstword := start / 64
+	endword := (end - 1) / 64
+	if firstword == endword {
+		return int(popcount(bitmap[firstword] & (^uint64(0) << uint(start%64)) & (^uint64(0) >> (uint(-end) % 64))))
+	}
+	answer := popcount(bitmap[firstword] & (^uint64(0) << uint(start%64)))
+	answer += popcntSlice(bitmap[firstword+1 : endword])
+	answer += popcount(bitmap[endword] & (^uint64(0) >> (uint(-end) % 64)))
+	return int(answer)
+}
+
+// containsBitmapRange checks whether all the bits in [start,end) are set
+func containsBitmapRange(bitmap []uint64, start int, end int) bool {
+	if start >= end {
+		return true
+	}
+	firstword := start / 64
+	endword := (end - 1) / 64
+	if firstword == endword {
+		mask := (^uint64(0) << uint(start%64)) & (^uint64(0) >> (uint(-end) % 64))
+		return bitmap[firstword]&mask == mask
+	}
+	mask := ^uint64(0) << uint(start%64)
+	if bitmap[firstword]&mask != mask {
+		return false
+	}
+	for i := firstword + 1; i < endword; i++ {
+		if bitmap[i] != ^uint64(0) {
+			return false
+		}
+	}
+	mask = ^uint64(0) >> (uint(-end) % 64)
+	return bitmap[endword]&mask == mask
+}
+
+// intersectsBitmapRange checks whether any of the bits in [start,end) is set
+func intersectsBitmapRange(bitmap []uint64, start int, end int) bool {
+	if start >= end {
+		return false
+	}
+	firstword := start / 64
+	endword := (end - 1) / 64
+	if firstword == endword {
+		return bitmap[firstword]&(^uint64(0)<<uint(start%64))&(^uint64(0)>>(uint(-end)%64)) != 0
+	}
+	if bitmap[firstword]&(^uint64(0)<<uint(start%64)) != 0 {
+		return true
+	}
+	for i := firstword + 1; i < endword; i++ {
+		if bitmap[i] != 0 {
+			return true
+		}
+	}
+	return bitmap[endword]&(^uint64(0)>>(uint(-end)%64)) != 0
+}
+
 func selectBitPosition(w uint64, j int) int {
 	seen := 0
 
@@ -0,0 +1,125 @@
+package roaring
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrOutOfOrder is returned by BitmapWriter when the integers are not
+// written in strictly increasing order
+var ErrOutOfOrder = errors.New("roaring: integers out of order")
+
+// BitmapWriter builds a bitmap from integers and ranges written in strictly
+// increasing order, such as sorted posting lists. It buffers the low bits of
+// the current 16-bit chunk and appends its container to the bitmap once the
+// chunk is done, so that writing is much cheaper than calling Add.
+type BitmapWriter struct {
+	bitmap *RoaringBitmap
+	key    uint16
+	values []uint16         // the buffered low bits, while they fit in an array container
+	bc     *bitmapContainer // the buffered low bits once they do not, or nil
+	next   uint64           // the smallest integer that can be written next
+}
+
+// NewBitmapWriter creates a writer for a new empty bitmap
+func NewBitmapWriter() *BitmapWriter {
+	return &BitmapWriter{bitmap: NewRoaringBitmap()}
+}
+
+// Add writes the integer x, which must be larger than all the integers
+// written before
+func (w *BitmapWriter) Add(x uint32) error {
+	if uint64(x) < w.next {
+		return fmt.Errorf("%w: %d after %d", ErrOutOfOrder, x, w.next-1)
+	}
+	w.setKey(highbits(x))
+	low := lowbits(x)
+	if w.bc == nil && len(w.values) < arrayDefaultMaxSize {
+		w.values = append(w.values, low)
+	} else {
+		w.toBitmap()
+		w.bc.bitmap[low/64] |= uint64(1) << (low % 64)
+		w.bc.cardinality++
+	}
+	w.next = uint64(x) + 1
+	return nil
+}
+
+// AddRange writes the integers in [rangeStart, rangeEnd), which must be
+// larger than all the integers written before. rangeEnd can be 1<<32 to
+// include the largest uint32.
+func (w *BitmapWriter) AddRange(rangeStart, rangeEnd uint64) error {
+	if rangeEnd > 1<<32 {
+		return fmt.Errorf("roaring: range end %d is past 1<<32", rangeEnd)
+	}
+	if rangeStart >= rangeEnd {
+		return nil
+	}
+	if rangeStart < w.next {
+		return fmt.Errorf("%w: range starting at %d after %d", ErrOutOfOrder, rangeStart, w.next-1)
+	}
+	for start := rangeStart; start < rangeEnd; {
+		end := (start>>16 + 1) << 16
+		if end > rangeEnd {
+			end = rangeEnd
+		}
+		w.setKey(uint16(start >> 16))
+		lo := int(start & 0xFFFF)
+		hi := lo + int(end-start)
+		if w.bc == nil && len(w.values)+hi-lo <= arrayDefaultMaxSize {
+			for v := lo; v < hi; v++ {
+				w.values = append(w.values, uint16(v))
+			}
+		} else {
+			w.toBitmap()
+			setBitmapRange(w.bc.bitmap, lo, hi)
+			w.bc.cardinality += hi - lo
+		}
+		start = end
+	}
+	w.next = rangeEnd
+	return nil
+}
+
+// Bitmap returns the bitmap made of all the integers written so far, and
+// resets the writer
+func (w *BitmapWriter) Bitmap() *RoaringBitmap {
+	w.flush()
+	answer := w.bitmap
+	*w = BitmapWriter{bitmap: NewRoaringBitmap(), values: w.values}
+	return answer
+}
+
+// setKey starts buffering the chunk with the given key, appending the
+// previous one to the bitmap
+func (w *BitmapWriter) setKey(key uint16) {
+	if key != w.key {
+		w.flush()
+		w.key = key
+	}
+}
+
+// toBitmap moves the buffered low bits to a bitmap container
+func (w *BitmapWriter) toBitmap() {
+	if w.bc != nil {
+		return
+	}
+	w.bc = newBitmapContainer()
+	for _, v := range w.values {
+		w.bc.bitmap[v/64] |= uint64(1) << (v % 64)
+	}
+	w.bc.cardinality = len(w.values)
+	w.values = w.values[:0]
+}
+
+func (w *BitmapWriter) flush() {
+	if w.bc != nil {
+		w.bitmap.highlowcontainer.appendContainer(w.key, w.bc)
+		w.bc = nil
+	} else if len(w.values) > 0 {
+		ac := newArrayContainerSize(len(w.values))
+		copy(ac.content, w.values)
+		w.bitmap.highlowcontainer.appendContainer(w.key, ac)
+		w.values = w.values[:0]
+	}
+}
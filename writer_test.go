@@ -0,0 +1,75 @@
+package roaring
+
+// to run just these tests: go test -run TestBitmapWriter*
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestBitmapWriter(t *testing.T) {
+	r := rand.New(rand.NewSource(22))
+	w := NewBitmapWriter()
+	expected := NewRoaringBitmap()
+	x := uint64(0)
+	for x < 1<<23 {
+		switch r.Intn(3) {
+		case 0:
+			if err := w.Add(uint32(x)); err != nil {
+				t.Fatalf("Failed adding %d: %v", x, err)
+			}
+			expected.Add(uint32(x))
+			x++
+		case 1:
+			end := x + uint64(r.Intn(1<<uint(r.Intn(18))))
+			if err := w.AddRange(x, end); err != nil {
+				t.Fatalf("Failed adding [%d,%d): %v", x, end, err)
+			}
+			expected.AddRange64(x, end)
+			x = end
+		}
+		x += uint64(r.Intn(1 << uint(r.Intn(16))))
+	}
+	if err := w.AddRange(1<<32-1<<17-3, 1<<32); err != nil {
+		t.Fatalf("Failed adding the top range: %v", err)
+	}
+	expected.AddRange64(1<<32-1<<17-3, 1<<32)
+	rb := w.Bitmap()
+	if !rb.Equals(expected) {
+		t.Errorf("Bad bitmap with cardinality %d, expected %d", rb.GetCardinality(), expected.GetCardinality())
+	}
+	if !w.Bitmap().IsEmpty() {
+		t.Errorf("The writer should be reset")
+	}
+}
+
+func TestBitmapWriterOrder(t *testing.T) {
+	w := NewBitmapWriter()
+	if err := w.Add(10); err != nil {
+		t.Fatalf("Failed adding: %v", err)
+	}
+	for _, err := range []error{w.Add(10), w.Add(3), w.AddRange(5, 20), w.AddRange(10, 11)} {
+		if !errors.Is(err, ErrOutOfOrder) {
+			t.Errorf("Writing out of order gave %v", err)
+		}
+	}
+	if err := w.AddRange(20, 20); err != nil {
+		t.Errorf("Writing an empty range gave %v", err)
+	}
+	if err := w.AddRange(11, 1<<32+1); err == nil {
+		t.Errorf("Writing past 1<<32 should fail")
+	}
+	if err := w.AddRange(11, 100); err != nil {
+		t.Errorf("Failed adding: %v", err)
+	}
+	if err := w.Add(4294967295); err != nil {
+		t.Errorf("Failed adding: %v", err)
+	}
+	if err := w.Add(4294967295); !errors.Is(err, ErrOutOfOrder) {
+		t.Errorf("Writing after the largest uint32 gave %v", err)
+	}
+	if w.Bitmap().GetCardinality() != 91 {
+		t.Errorf("Bad bitmap")
+	}
+}